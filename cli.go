@@ -9,14 +9,14 @@ import (
 
 	"github.com/alecthomas/kong"
 	"github.com/fujiwara/sloghandler"
-	"github.com/mattn/go-isatty"
 )
 
 type CLI struct {
 	Cluster         string `help:"ECS cluster name" short:"c" env:"ECS_CLUSTER"`
 	Region          string `help:"AWS region" short:"r" env:"AWS_REGION"`
-	Output          string `help:"output format (table, tsv, json)" short:"o" default:"table" enum:"table,tsv,json" env:"ECSTA_OUTPUT"`
+	Output          string `help:"output format (table, tsv, json, csv, markdown, yaml, json-array)" short:"o" default:"table" enum:"table,tsv,json,csv,markdown,yaml,json-array" env:"ECSTA_OUTPUT"`
 	TaskFormatQuery string `help:"A jq query to format task in selector" short:"q" env:"ECSTA_TASK_FORMAT_QUERY"`
+	Format          string `help:"A Go template to format tasks in list and selector (e.g. '{{.TaskArn | name}} {{.LastStatus}}')" env:"ECSTA_FORMAT"`
 	Debug           bool   `help:"enable debug output" env:"ECSTA_DEBUG"`
 	LogFormat       string `help:"log format (text, json)" short:"l" default:"text" enum:"text,json" env:"ECSTA_LOG_FORMAT"`
 
@@ -24,7 +24,7 @@ type CLI struct {
 	Describe    *DescribeOption    `cmd:"" help:"Describe tasks"`
 	Exec        *ExecOption        `cmd:"" help:"Execute a command on a task"`
 	List        *ListOption        `cmd:"" help:"List tasks"`
-	Logs        *LogsOption        `cmd:"" help:"Show log messages of a task"`
+	Logs        *LogsCommand       `cmd:"" help:"Show log messages of a task"`
 	Portforward *PortforwardOption `cmd:"" help:"Forward a port of a task"`
 	Stop        *StopOption        `cmd:"" help:"Stop a task"`
 	Trace       *TraceOption       `cmd:"" help:"Trace a task"`
@@ -54,7 +54,7 @@ func RunCLI(ctx context.Context, args []string) error {
 		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
 	default: // text
 		// Enable color only if stderr is a terminal
-		useColor := isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+		useColor := isTerminal(os.Stderr)
 		handler = sloghandler.NewLogHandler(
 			os.Stderr,
 			&sloghandler.HandlerOptions{
@@ -72,7 +72,12 @@ func RunCLI(ctx context.Context, args []string) error {
 		return err
 	}
 	app.Config.OverrideCLI(&cli)
-	cmd := strings.Fields(kctx.Command())[0]
+	words := strings.Fields(kctx.Command())
+	cmd := words[0]
+	if cmd == "logs" {
+		// logs has subcommands
+		cmd = strings.Join(words[:2], " ")
+	}
 	return app.Dispatch(ctx, cmd, &cli)
 }
 
@@ -86,8 +91,10 @@ func (app *Ecsta) Dispatch(ctx context.Context, command string, cli *CLI) error
 		return app.RunExec(ctx, cli.Exec)
 	case "list":
 		return app.RunList(ctx, cli.List)
-	case "logs":
-		return app.RunLogs(ctx, cli.Logs)
+	case "logs show":
+		return app.RunLogs(ctx, cli.Logs.Show)
+	case "logs insights":
+		return app.RunLogsInsights(ctx, cli.Logs.Insights)
 	case "portforward":
 		return app.RunPortforward(ctx, cli.Portforward)
 	case "stop":
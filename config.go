@@ -15,19 +15,36 @@ import (
 
 type Config struct {
 	FilterCommand   string `help:"command to run to filter messages" json:"filter_command"`
-	Output          string `help:"output format (table, tsv or json)" enum:"table,tsv,json" default:"table" json:"output"`
+	Output          string `help:"output format (table, tsv, json, csv, markdown, yaml or json-array)" enum:"table,tsv,json,csv,markdown,yaml,json-array" default:"table" json:"output"`
 	TaskFormatQuery string `help:"A jq query to format task in selector" json:"task_format_query"`
+	TaskFormat      string `help:"A Go template to format tasks in list and selector" json:"task_format"`
+	Columns         string `help:"columns of tasks in list and selector (comma separated)" json:"columns"`
+
+	// CustomColumns defines columns by jq queries for tasks. It is edited in the configuration file directly.
+	CustomColumns map[string]string `json:"custom_columns,omitempty"`
 }
 
-func (c *Config) ConfigElements() []ConfigElement {
+// stringFields returns the indexes of string fields, which are configurable elements.
+func (c *Config) stringFields() []int {
 	v := reflect.ValueOf(c).Elem()
-	elements := make([]ConfigElement, v.NumField())
+	var fields []int
 	for i := 0; i < v.NumField(); i++ {
-		elements[i] = ConfigElement{
+		if v.Field(i).Kind() == reflect.String {
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
+
+func (c *Config) ConfigElements() []ConfigElement {
+	v := reflect.ValueOf(c).Elem()
+	var elements []ConfigElement
+	for _, i := range c.stringFields() {
+		elements = append(elements, ConfigElement{
 			Name:        v.Type().Field(i).Tag.Get("json"),
 			Description: v.Type().Field(i).Tag.Get("help"),
 			Default:     v.Type().Field(i).Tag.Get("default"),
-		}
+		})
 	}
 	return elements
 }
@@ -41,7 +58,7 @@ func (c *Config) Get(name string) string {
 	v := reflect.ValueOf(c).Elem()
 	name = strings.ToLower(name)
 
-	for i := 0; i < v.NumField(); i++ {
+	for _, i := range c.stringFields() {
 		if v.Type().Field(i).Tag.Get("json") == name {
 			return v.Field(i).String()
 		}
@@ -53,7 +70,7 @@ func (c *Config) Set(name, value string) {
 	v := reflect.ValueOf(c).Elem()
 	name = strings.ToLower(name)
 
-	for i := 0; i < v.NumField(); i++ {
+	for _, i := range c.stringFields() {
 		if v.Type().Field(i).Tag.Get("json") == name {
 			if v.Field(i).CanSet() {
 				v.Field(i).SetString(value)
@@ -67,7 +84,7 @@ func (c *Config) Set(name, value string) {
 func (c *Config) fillDefault() {
 	v := reflect.ValueOf(c).Elem()
 
-	for i := 0; i < v.NumField(); i++ {
+	for _, i := range c.stringFields() {
 		if v.Field(i).String() == "" {
 			v.Field(i).SetString(v.Type().Field(i).Tag.Get("default"))
 		}
@@ -78,7 +95,7 @@ func (c *Config) Names() []string {
 	v := reflect.ValueOf(c).Elem()
 	var names []string
 
-	for i := 0; i < v.NumField(); i++ {
+	for _, i := range c.stringFields() {
 		name := v.Type().Field(i).Tag.Get("json")
 		names = append(names, name)
 	}
@@ -92,6 +109,9 @@ func (c *Config) OverrideCLI(cli *CLI) {
 	if cli.TaskFormatQuery != "" {
 		c.TaskFormatQuery = cli.TaskFormatQuery
 	}
+	if cli.Format != "" {
+		c.TaskFormat = cli.Format
+	}
 }
 
 type ConfigElement struct {
@@ -150,7 +170,7 @@ func loadConfigFile() (*Config, error) {
 
 func reConfigure(c *Config) error {
 	slog.Info("configuration file", "path", configFilePath())
-	nc := &Config{}
+	nc := &Config{CustomColumns: c.CustomColumns}
 
 	for _, elm := range c.ConfigElements() {
 		current := c.Get(elm.Name)
@@ -2,6 +2,7 @@ package ecsta_test
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/fujiwara/ecsta"
@@ -9,10 +10,14 @@ import (
 )
 
 func TestConfig(t *testing.T) {
-	t.Setenv("XDG_CONFIG_HOME", "testdata/config")
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
 	ecsta.SetConfigDir()
 
-	if err := os.WriteFile("testdata/config/ecsta/config.json", []byte(`{
+	if err := os.MkdirAll(filepath.Join(dir, "ecsta"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ecsta", "config.json"), []byte(`{
 	"filter_command": "peco",
 	"output": "",
 	"task_format_query": ".id"
@@ -26,7 +31,7 @@ func TestConfig(t *testing.T) {
 	}
 
 	names := conf.Names()
-	if d := cmp.Diff(names, []string{"filter_command", "output", "task_format_query"}); d != "" {
+	if d := cmp.Diff(names, []string{"filter_command", "output", "task_format_query", "task_format", "columns"}); d != "" {
 		t.Errorf("unexpected config names: %s", d)
 	}
 
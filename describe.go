@@ -9,6 +9,7 @@ type DescribeOption struct {
 	ID      string  `help:"task ID"`
 	Family  *string `help:"task definition family name"`
 	Service *string `help:"ECS service name. When combined with --family, tasks of other services sharing the family are excluded."`
+	Network bool    `help:"show a summary of network interfaces of the task"`
 }
 
 func (app *Ecsta) RunDescribe(ctx context.Context, opt *DescribeOption) error {
@@ -19,6 +20,9 @@ func (app *Ecsta) RunDescribe(ctx context.Context, opt *DescribeOption) error {
 	if err != nil {
 		return fmt.Errorf("failed to select tasks: %w", err)
 	}
+	if opt.Network {
+		return app.describeNetwork(ctx, task)
+	}
 	f, err := newTaskFormatterJSON(app.w, formatterOption{})
 	if err != nil {
 		return err
@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -25,10 +28,12 @@ type Ecsta struct {
 	Config *Config
 
 	region  string
+	profile string // empty for the default credentials
 	cluster string
 
 	awscfg aws.Config
 	ecs    *ecs.Client
+	ec2    *ec2.Client
 	ssm    *ssm.Client
 	logs   *cloudwatchlogs.Client
 	w      io.Writer
@@ -48,20 +53,49 @@ func New(ctx context.Context, region, cluster string) (*Ecsta, error) {
 		Config: conf,
 
 		cluster: cluster,
-		region:  awscfg.Region,
-		awscfg:  awscfg,
-		ecs:     ecs.NewFromConfig(awscfg),
-		ssm:     ssm.NewFromConfig(awscfg),
-		logs:    cloudwatchlogs.NewFromConfig(awscfg),
 		w:       os.Stdout,
 	}
+	app.setAWSConfig(awscfg)
 	return app, nil
 }
 
+func (app *Ecsta) setAWSConfig(awscfg aws.Config) {
+	app.region = awscfg.Region
+	app.awscfg = awscfg
+	app.ecs = ecs.NewFromConfig(awscfg)
+	app.ec2 = ec2.NewFromConfig(awscfg)
+	app.ssm = ssm.NewFromConfig(awscfg)
+	app.logs = cloudwatchlogs.NewFromConfig(awscfg)
+}
+
+// forTarget returns a copy of app with the clients for the region and the profile.
+// The empty profile means the default credentials.
+func (app *Ecsta) forTarget(ctx context.Context, region, profile string) (*Ecsta, error) {
+	opts := []func(*awsConfig.LoadOptions) error{awsConfig.WithRegion(region)}
+	if profile != "" {
+		opts = append(opts, awsConfig.WithSharedConfigProfile(profile))
+	}
+	awscfg, err := awsConfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for region %q profile %q: %w", region, profile, err)
+	}
+	t := &Ecsta{
+		Config:  app.Config,
+		cluster: app.cluster,
+		profile: profile,
+		w:       app.w,
+	}
+	t.setAWSConfig(awscfg)
+	return t, nil
+}
+
 type optionListTasks struct {
-	family  *string
-	service *string
-	tags    map[string]string
+	family     *string
+	service    *string
+	tags       map[string]string
+	statuses   []types.DesiredStatus // RUNNING and STOPPED when empty
+	launchType types.LaunchType
+	startedBy  *string // filtered after DescribeTasks
 }
 
 type optionDescribeTasks struct {
@@ -80,7 +114,7 @@ func (app *Ecsta) describeTasks(ctx context.Context, opt *optionDescribeTasks) (
 	return out.Tasks, nil
 }
 
-func (app *Ecsta) listTasks(ctx context.Context, opt *optionListTasks) ([]types.Task, error) {
+func (app *Ecsta) listTasks(ctx context.Context, cluster string, opt *optionListTasks) ([]types.Task, error) {
 	tasks := []types.Task{}
 	var inputs []*ecs.ListTasksInput
 	// ListTasks API does not accept Family and ServiceName at the same time.
@@ -91,18 +125,24 @@ func (app *Ecsta) listTasks(ctx context.Context, opt *optionListTasks) ([]types.
 	// sibling services.
 	if opt.family != nil && opt.service != nil {
 		inputs = []*ecs.ListTasksInput{
-			{Cluster: &app.cluster, Family: opt.family},
+			{Cluster: &cluster, Family: opt.family},
 		}
 	} else {
 		inputs = []*ecs.ListTasksInput{
-			{Cluster: &app.cluster, Family: opt.family, ServiceName: opt.service},
+			{Cluster: &cluster, Family: opt.family, ServiceName: opt.service},
 		}
 	}
+	statuses := opt.statuses
+	if len(statuses) == 0 {
+		statuses = []types.DesiredStatus{types.DesiredStatusRunning, types.DesiredStatusStopped}
+	}
 	for _, input := range inputs {
-		for _, status := range []types.DesiredStatus{types.DesiredStatusRunning, types.DesiredStatusStopped} {
-			input := input
+		// StartedBy is not sent because it must be the only filter of ListTasks
+		input.LaunchType = opt.launchType
+		for _, status := range statuses {
+			input := *input
 			input.DesiredStatus = status
-			tp := ecs.NewListTasksPaginator(app.ecs, input)
+			tp := ecs.NewListTasksPaginator(app.ecs, &input)
 			for tp.HasMorePages() {
 				to, err := tp.NextPage(ctx)
 				if err != nil {
@@ -112,7 +152,7 @@ func (app *Ecsta) listTasks(ctx context.Context, opt *optionListTasks) ([]types.
 					continue
 				}
 				out, err := app.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
-					Cluster: &app.cluster,
+					Cluster: &cluster,
 					Tasks:   to.TaskArns,
 					Include: []types.TaskField{"TAGS"},
 				})
@@ -128,6 +168,12 @@ func (app *Ecsta) listTasks(ctx context.Context, opt *optionListTasks) ([]types.
 		tasks = filterTasksByService(tasks, aws.ToString(opt.service))
 	}
 
+	if opt.startedBy != nil {
+		tasks = lo.Filter(tasks, func(task types.Task, _ int) bool {
+			return aws.ToString(task.StartedBy) == *opt.startedBy
+		})
+	}
+
 	// filter by tags
 	if len(opt.tags) > 0 {
 		tasks = lo.Filter(tasks, func(task types.Task, i int) bool {
@@ -150,6 +196,37 @@ func (app *Ecsta) listTasks(ctx context.Context, opt *optionListTasks) ([]types.
 	}), nil
 }
 
+// listTasksConcurrency is the maximum number of clusters queried concurrently by listTasksInClusters.
+var listTasksConcurrency = 4
+
+// listTasksInClusters lists tasks in the clusters concurrently.
+// Tasks are returned in the order of the clusters. Errors of all the failed clusters are joined.
+func (app *Ecsta) listTasksInClusters(ctx context.Context, clusters []string, opt *optionListTasks) ([]types.Task, error) {
+	results := make([][]types.Task, len(clusters))
+	errs := make([]error, len(clusters))
+	sem := make(chan struct{}, listTasksConcurrency)
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tasks, err := app.listTasks(ctx, cluster, opt)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to list tasks in cluster %s: %w", arnToName(cluster), err)
+				return
+			}
+			results[i] = tasks
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return slices.Concat(results...), nil
+}
+
 // filterTasksByService keeps tasks that belong to the specified service or are
 // not associated with any service (e.g. tasks launched via RunTask). Tasks
 // associated with other services are excluded. Service association is detected
@@ -237,7 +314,7 @@ func (app *Ecsta) findTask(ctx context.Context, opt *optionFindTask) (types.Task
 			return types.Task{}, fmt.Errorf("multiple tasks found: %s", opt.id)
 		}
 	}
-	tasks, err := app.listTasks(ctx, &optionListTasks{
+	tasks, err := app.listTasks(ctx, app.cluster, &optionListTasks{
 		family:  opt.family,
 		service: opt.service,
 	})
@@ -259,14 +336,13 @@ func (app *Ecsta) findTask(ctx context.Context, opt *optionFindTask) (types.Task
 
 	buf := new(bytes.Buffer)
 	fopt := formatterOption{
-		Format:       "tsv",
-		HasHeader:    false,
-		AppendTaskID: true,
+		Format:        "tsv",
+		HasHeader:     false,
+		AppendTaskID:  true,
+		Columns:       parseColumns(app.Config.Columns),
+		CustomColumns: app.Config.CustomColumns,
 	} // default
-	if query := app.Config.TaskFormatQuery; query != "" {
-		fopt.Format = "json"
-		fopt.Query = query
-	}
+	app.applyTaskFormat(&fopt)
 	f, err := newTaskFormatter(buf, fopt)
 	if err != nil {
 		return types.Task{}, fmt.Errorf("failed to create formatter: %w", err)
@@ -291,6 +367,18 @@ func (app *Ecsta) findTask(ctx context.Context, opt *optionFindTask) (types.Task
 	return types.Task{}, fmt.Errorf("task %s not found", id)
 }
 
+// applyTaskFormat overrides the format by the Go template or the jq query in the configuration.
+// The template takes precedence over the query.
+func (app *Ecsta) applyTaskFormat(fopt *formatterOption) {
+	if tmpl := app.Config.TaskFormat; tmpl != "" {
+		fopt.Format = "template"
+		fopt.Template = tmpl
+	} else if query := app.Config.TaskFormatQuery; query != "" {
+		fopt.Format = "json"
+		fopt.Query = query
+	}
+}
+
 func (app *Ecsta) SetCluster(ctx context.Context) error {
 	if app.cluster == "" {
 		cluster, err := app.selectCluster(ctx)
@@ -335,3 +423,13 @@ func (app *Ecsta) findContainerName(ctx context.Context, task types.Task, name s
 	}
 	return container, nil
 }
+
+func (app *Ecsta) describeTaskDefinition(ctx context.Context, task types.Task) (*types.TaskDefinition, error) {
+	res, err := app.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: task.TaskDefinitionArn,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe task definition: %w", err)
+	}
+	return res.TaskDefinition, nil
+}
@@ -1,6 +1,11 @@
 package ecsta
 
-import "io"
+import (
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
 
 type FormatterOption formatterOption
 
@@ -13,3 +18,54 @@ var (
 	SaveConfig   = saveConfig
 	SetConfigDir = setConfigDir
 )
+
+var TaskInLogsRange = taskInLogsRange
+
+type LogRecord = logRecord
+
+func NewLogEncoder(w io.Writer, jsonFormat bool) logEncoder {
+	return newLogEncoder(w, jsonFormat)
+}
+
+// TaskLogStreams returns log streams formatted as "group stream container".
+func TaskLogStreams(task types.Task, td *types.TaskDefinition, container string) ([]string, []string, []string) {
+	streams, names, notes := taskLogStreams(task, td, container)
+	ss := make([]string, 0, len(streams))
+	for _, s := range streams {
+		ss = append(ss, s.group+" "+s.stream+" "+s.container)
+	}
+	return ss, names, notes
+}
+
+var NewLogMerger = newLogMerger
+
+func NewLogRecordAt(ts time.Time, container, msg string) *logRecord {
+	return &logRecord{Time: ts.Format(time.RFC3339), Container: container, Msg: msg, ts: ts}
+}
+
+var NewLogGrepEncoder = newLogGrepEncoder
+
+var NewLogJSONParseEncoder = newLogJSONParseEncoder
+
+// InsightsQueryString returns the query for the log streams.
+func InsightsQueryString(streams []string, query string) string {
+	ss := make([]logStream, 0, len(streams))
+	for _, s := range streams {
+		ss = append(ss, logStream{group: "/ecs/app", stream: s})
+	}
+	return insightsQueryString(ss, query)
+}
+
+var InsightsResultRows = insightsResultRows
+
+var NewRowFormatter = newRowFormatter
+
+func NewContainerFormatter(w io.Writer, opt FormatterOption) (taskFormatter, error) {
+	return newContainerFormatter(w, formatterOption(opt))
+}
+
+type LogFileSummary = logFileSummary
+
+var NewLogFileEncoder = newLogFileEncoder
+
+var NewLogPrettyEncoder = newLogPrettyEncoder
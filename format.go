@@ -1,17 +1,23 @@
 package ecsta
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/itchyny/gojq"
 	"github.com/olekukonko/tablewriter"
 	"github.com/olekukonko/tablewriter/tw"
+	"gopkg.in/yaml.v3"
 )
 
 var taskFormatterColumns = []string{
@@ -26,33 +32,195 @@ var taskFormatterColumns = []string{
 }
 
 type formatterOption struct {
-	Format       string
-	HasHeader    bool
-	AppendTaskID bool
-	Query        string
-	WithTags     bool
+	Format        string
+	HasHeader     bool
+	AppendTaskID  bool
+	Query         string
+	Template      string // Go template for the template format
+	WithTags      bool
+	WithCluster   bool                                 // add the Cluster column at the beginning
+	WithRegion    bool                                 // add the Region column at the beginning
+	WithProfile   bool                                 // add the Profile column at the beginning
+	Profiles      map[string]string                    // task ARN -> AWS profile name for the Profile column
+	Interfaces    map[string]ec2Types.NetworkInterface // ENI ID -> network interface by the EC2 API for PublicIP and SecurityGroups columns
+	Columns       []string                             // columns to show. taskFormatterColumns by default
+	CustomColumns map[string]string                    // column name -> jq query for the task
+
+	extractors []taskColumnFunc
+}
+
+type taskColumnFunc func(types.Task) string
+
+// taskColumnExtractors extract values of the columns from a task.
+var taskColumnExtractors = map[string]taskColumnFunc{
+	"ID":             func(t types.Task) string { return arnToName(*t.TaskArn) },
+	"Cluster":        func(t types.Task) string { return arnToName(aws.ToString(t.ClusterArn)) },
+	"Region":         func(t types.Task) string { return arnToRegion(aws.ToString(t.TaskArn)) },
+	"TaskDefinition": func(t types.Task) string { return arnToName(*t.TaskDefinitionArn) },
+	"Instance":       func(t types.Task) string { return arnToName(aws.ToString(t.ContainerInstanceArn)) },
+	"LastStatus":     func(t types.Task) string { return aws.ToString(t.LastStatus) },
+	"DesiredStatus":  func(t types.Task) string { return aws.ToString(t.DesiredStatus) },
+	"CreatedAt":      func(t types.Task) string { return formatTime(t.CreatedAt) },
+	"Group":          func(t types.Task) string { return aws.ToString(t.Group) },
+	"Type":           func(t types.Task) string { return string(t.LaunchType) },
+	"Tags":           func(t types.Task) string { return formatTags(t.Tags) },
+
+	"HealthStatus":     func(t types.Task) string { return string(t.HealthStatus) },
+	"PrivateIP":        taskPrivateIP,
+	"CPU":              func(t types.Task) string { return aws.ToString(t.Cpu) },
+	"Memory":           func(t types.Task) string { return aws.ToString(t.Memory) },
+	"StartedBy":        func(t types.Task) string { return aws.ToString(t.StartedBy) },
+	"StartedAt":        func(t types.Task) string { return formatTime(t.StartedAt) },
+	"StoppedAt":        func(t types.Task) string { return formatTime(t.StoppedAt) },
+	"StoppedReason":    func(t types.Task) string { return aws.ToString(t.StoppedReason) },
+	"StopCode":         func(t types.Task) string { return string(t.StopCode) },
+	"AvailabilityZone": func(t types.Task) string { return aws.ToString(t.AvailabilityZone) },
+	"PlatformVersion":  func(t types.Task) string { return aws.ToString(t.PlatformVersion) },
+
+	"ENI":         taskNetworkColumn(func(ni taskNetworkInterface) string { return ni.ID }),
+	"Subnet":      taskNetworkColumn(func(ni taskNetworkInterface) string { return ni.Subnet }),
+	"PrivateIPv6": taskNetworkColumn(func(ni taskNetworkInterface) string { return ni.PrivateIPv6 }),
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(time.Local).Format(time.RFC3339)
+}
+
+// taskPrivateIP returns the private IPv4 address of the task.
+func taskPrivateIP(task types.Task) string {
+	for _, c := range task.Containers {
+		for _, ni := range c.NetworkInterfaces {
+			if ip := aws.ToString(ni.PrivateIpv4Address); ip != "" {
+				return ip
+			}
+		}
+	}
+	for _, a := range task.Attachments {
+		for _, d := range a.Details {
+			if aws.ToString(d.Name) == "privateIPv4Address" {
+				return aws.ToString(d.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// parseColumns parses comma separated column names.
+func parseColumns(s string) []string {
+	var cols []string
+	for _, col := range strings.Split(s, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+func (o *formatterOption) columns() []string {
+	cols := slices.Clone(o.Columns)
+	if len(cols) == 0 {
+		cols = slices.Clone(taskFormatterColumns)
+	}
+	if o.WithTags && !slices.Contains(cols, "Tags") {
+		cols = append(cols, "Tags")
+	}
+	for _, c := range []struct {
+		name string
+		with bool
+	}{
+		{"Cluster", o.WithCluster},
+		{"Region", o.WithRegion},
+		{"Profile", o.WithProfile},
+	} {
+		if c.with && !slices.Contains(cols, c.name) {
+			cols = append([]string{c.name}, cols...)
+		}
+	}
+	if o.AppendTaskID && cols[0] != "ID" {
+		// the task ID must be at the beginning of the line for the selector
+		cols = append([]string{"ID"}, cols...)
+	}
+	return cols
+}
+
+// prepare resolves extractors of the columns.
+func (o *formatterOption) prepare() error {
+	o.extractors = nil
+	for _, col := range o.columns() {
+		if query, ok := o.CustomColumns[col]; ok {
+			f, err := newTaskColumnQuery(query)
+			if err != nil {
+				return fmt.Errorf("invalid query for column %s: %w", col, err)
+			}
+			o.extractors = append(o.extractors, f)
+			continue
+		}
+		switch col {
+		case "Profile":
+			profiles := o.Profiles
+			o.extractors = append(o.extractors, func(t types.Task) string { return profiles[aws.ToString(t.TaskArn)] })
+			continue
+		case "PublicIP":
+			o.extractors = append(o.extractors, ec2NetworkColumn(o.Interfaces, eniPublicIP))
+			continue
+		case "SecurityGroups":
+			o.extractors = append(o.extractors, ec2NetworkColumn(o.Interfaces, eniSecurityGroups))
+			continue
+		}
+		f, ok := taskColumnExtractors[col]
+		if !ok {
+			return fmt.Errorf("unknown column %s. available columns: %s", col, strings.Join(availableTaskColumns(o.CustomColumns), ","))
+		}
+		o.extractors = append(o.extractors, f)
+	}
+	return nil
+}
+
+func availableTaskColumns(custom map[string]string) []string {
+	cols := slices.Sorted(maps.Keys(taskColumnExtractors))
+	cols = append(cols, "Profile")
+	cols = append(cols, ec2NetworkColumns...)
+	return append(cols, slices.Sorted(maps.Keys(custom))...)
 }
 
-func (o *formatterOption) Columns() []string {
-	if o.WithTags {
-		return append(taskFormatterColumns, "Tags")
+// newTaskColumnQuery returns an extractor that runs the jq query for the task in the JSON form of the API.
+func newTaskColumnQuery(query string) (taskColumnFunc, error) {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return nil, err
 	}
-	return taskFormatterColumns
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, err
+	}
+	return func(task types.Task) string {
+		m, err := toAPIMap(task)
+		if err != nil {
+			return ""
+		}
+		v, ok := code.Run(m).Next()
+		if !ok || v == nil {
+			return ""
+		}
+		switch v := v.(type) {
+		case error:
+			return ""
+		case string:
+			return v
+		default:
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+	}, nil
 }
 
 func (o *formatterOption) taskToColumns(task types.Task) []string {
-	ss := []string{
-		arnToName(*task.TaskArn),
-		arnToName(*task.TaskDefinitionArn),
-		arnToName(aws.ToString(task.ContainerInstanceArn)),
-		aws.ToString(task.LastStatus),
-		aws.ToString(task.DesiredStatus),
-		task.CreatedAt.In(time.Local).Format(time.RFC3339),
-		aws.ToString(task.Group),
-		string(task.LaunchType),
-	}
-	if o.WithTags {
-		ss = append(ss, formatTags(task.Tags))
+	ss := make([]string, 0, len(o.extractors))
+	for _, f := range o.extractors {
+		ss = append(ss, f(task))
 	}
 	return ss
 }
@@ -60,9 +228,14 @@ func (o *formatterOption) taskToColumns(task types.Task) []string {
 type taskFormatterFunc func(io.Writer, formatterOption) (taskFormatter, error)
 
 var taskFormatters map[string]taskFormatterFunc = map[string]taskFormatterFunc{
-	"table": newTaskFormatterTable,
-	"tsv":   newTaskFormatterTSV,
-	"json":  newTaskFormatterJSON,
+	"table":      newTaskFormatterTable,
+	"tsv":        newTaskFormatterTSV,
+	"json":       newTaskFormatterJSON,
+	"csv":        newTaskFormatterCSV,
+	"markdown":   newTaskFormatterMarkdown,
+	"yaml":       newTaskFormatterYAML,
+	"json-array": newTaskFormatterJSONArray,
+	"template":   newTaskFormatterTemplate,
 }
 
 func newTaskFormatter(w io.Writer, opt formatterOption) (taskFormatter, error) {
@@ -90,19 +263,26 @@ type taskFormatterTable struct {
 	opt   *formatterOption
 }
 
-func newTaskFormatterTable(w io.Writer, opt formatterOption) (taskFormatter, error) {
-	table := tablewriter.NewTable(w,
+func newTable(w io.Writer) *tablewriter.Table {
+	return tablewriter.NewTable(w,
 		tablewriter.WithRendition(tw.Rendition{
 			Symbols: tw.NewSymbols(tw.StyleASCII),
 			Borders: tw.Border{Left: tw.On, Top: tw.Off, Right: tw.On, Bottom: tw.Off},
 		}),
 	)
+}
+
+func newTaskFormatterTable(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	if err := opt.prepare(); err != nil {
+		return nil, err
+	}
+	table := newTable(w)
 	t := &taskFormatterTable{
 		table: table,
 		opt:   &opt,
 	}
 	if opt.HasHeader {
-		t.table.Header(opt.Columns())
+		t.table.Header(opt.columns())
 	}
 	return t, nil
 }
@@ -121,12 +301,15 @@ type taskFormatterTSV struct {
 }
 
 func newTaskFormatterTSV(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	if err := opt.prepare(); err != nil {
+		return nil, err
+	}
 	t := &taskFormatterTSV{
 		w:   w,
 		opt: &opt,
 	}
 	if opt.HasHeader {
-		fmt.Fprintln(t.w, strings.Join(taskFormatterColumns, "\t"))
+		fmt.Fprintln(t.w, strings.Join(opt.columns(), "\t"))
 	}
 	return t, nil
 }
@@ -175,7 +358,323 @@ func (t *taskFormatterJSON) AddTask(task types.Task) {
 func (t *taskFormatterJSON) Close() {
 }
 
-func MarshalJSONForAPI(v any, query *gojq.Query) ([]byte, error) {
+type taskFormatterCSV struct {
+	w   *csv.Writer
+	opt *formatterOption
+}
+
+func newTaskFormatterCSV(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	if err := opt.prepare(); err != nil {
+		return nil, err
+	}
+	t := &taskFormatterCSV{
+		w:   csv.NewWriter(w),
+		opt: &opt,
+	}
+	if opt.HasHeader {
+		t.w.Write(opt.columns())
+	}
+	return t, nil
+}
+
+func (t *taskFormatterCSV) AddTask(task types.Task) {
+	t.w.Write(t.opt.taskToColumns(task))
+}
+
+func (t *taskFormatterCSV) Close() {
+	t.w.Flush()
+}
+
+// taskFormatterMarkdown formats tasks as a Markdown table. The header is always written.
+type taskFormatterMarkdown struct {
+	w   io.Writer
+	opt *formatterOption
+}
+
+func newTaskFormatterMarkdown(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	if err := opt.prepare(); err != nil {
+		return nil, err
+	}
+	writeMarkdownHeader(w, opt.columns())
+	return &taskFormatterMarkdown{w: w, opt: &opt}, nil
+}
+
+func (t *taskFormatterMarkdown) AddTask(task types.Task) {
+	writeMarkdownRow(t.w, t.opt.taskToColumns(task))
+}
+
+func (t *taskFormatterMarkdown) Close() {
+}
+
+func writeMarkdownHeader(w io.Writer, columns []string) {
+	writeMarkdownRow(w, columns)
+	seps := make([]string, len(columns))
+	for i := range seps {
+		seps[i] = "---"
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(seps, " | "))
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+func writeMarkdownRow(w io.Writer, row []string) {
+	cells := make([]string, len(row))
+	for i, s := range row {
+		cells[i] = markdownEscaper.Replace(s)
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+}
+
+// taskFormatterDocument collects tasks in the JSON form of the API and writes them as a single document on Close.
+type taskFormatterDocument struct {
+	w      io.Writer
+	gojq   *gojq.Query
+	values []any
+	encode func(io.Writer, []any) error
+}
+
+func newTaskFormatterDocument(w io.Writer, opt formatterOption, encode func(io.Writer, []any) error) (*taskFormatterDocument, error) {
+	f := &taskFormatterDocument{
+		w:      w,
+		values: []any{},
+		encode: encode,
+	}
+	if opt.Query != "" {
+		query, err := gojq.Parse(opt.Query)
+		if err != nil {
+			return nil, err
+		}
+		f.gojq = query
+	}
+	return f, nil
+}
+
+func newTaskFormatterYAML(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	return newTaskFormatterDocument(w, opt, encodeYAML)
+}
+
+func newTaskFormatterJSONArray(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	return newTaskFormatterDocument(w, opt, encodeJSONArray)
+}
+
+func (t *taskFormatterDocument) AddTask(task types.Task) {
+	v, ok, err := queryForAPI(task, t.gojq)
+	if err != nil {
+		panic(err)
+	}
+	if ok {
+		t.values = append(t.values, v)
+	}
+}
+
+func (t *taskFormatterDocument) Close() {
+	if err := t.encode(t.w, t.values); err != nil {
+		panic(err)
+	}
+}
+
+func encodeYAML(w io.Writer, v []any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func encodeJSONArray(w io.Writer, v []any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// rowFormatter formats rows of arbitrary columns (e.g. query results) in the output format.
+type rowFormatter interface {
+	AddRow([]string)
+	Close()
+}
+
+func newRowFormatter(w io.Writer, format string, columns []string) (rowFormatter, error) {
+	switch format {
+	case "table":
+		table := newTable(w)
+		table.Header(columns)
+		return &rowFormatterTable{table: table}, nil
+	case "tsv":
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+		return &rowFormatterTSV{w: w}, nil
+	case "json":
+		return &rowFormatterJSON{enc: json.NewEncoder(w), columns: columns}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		return &rowFormatterCSV{w: cw}, nil
+	case "markdown":
+		writeMarkdownHeader(w, columns)
+		return &rowFormatterMarkdown{w: w}, nil
+	case "yaml":
+		return &rowFormatterDocument{w: w, columns: columns, rows: []any{}, encode: encodeYAML}, nil
+	case "json-array":
+		return &rowFormatterDocument{w: w, columns: columns, rows: []any{}, encode: encodeJSONArray}, nil
+	}
+	return nil, fmt.Errorf("unknown row formatter: %s", format)
+}
+
+// containerColumns are the columns of containers following the task columns in containerFormatter.
+var containerColumns = []string{
+	"Name",
+	"Image",
+	"ImageDigest",
+	"LastStatus",
+	"HealthStatus",
+	"ExitCode",
+	"Reason",
+	"RuntimeID",
+}
+
+// containerFormatter formats containers of tasks, a row per container.
+// Rows start with the task ID (and Profile, Region and Cluster if enabled by opt).
+type containerFormatter struct {
+	rows rowFormatter
+	opt  *formatterOption
+}
+
+func newContainerFormatter(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	opt.Columns = []string{"ID"}
+	opt.WithTags = false
+	if err := opt.prepare(); err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, col := range opt.columns() {
+		if col == "ID" {
+			col = "TaskID"
+		}
+		columns = append(columns, col)
+	}
+	rows, err := newRowFormatter(w, opt.Format, append(columns, containerColumns...))
+	if err != nil {
+		return nil, err
+	}
+	return &containerFormatter{rows: rows, opt: &opt}, nil
+}
+
+func (f *containerFormatter) AddTask(task types.Task) {
+	taskCols := f.opt.taskToColumns(task)
+	for _, c := range task.Containers {
+		f.rows.AddRow(append(slices.Clone(taskCols), containerToColumns(c)...))
+	}
+}
+
+func (f *containerFormatter) Close() {
+	f.rows.Close()
+}
+
+func containerToColumns(c types.Container) []string {
+	var exitCode string
+	if c.ExitCode != nil {
+		exitCode = strconv.Itoa(int(*c.ExitCode))
+	}
+	return []string{
+		aws.ToString(c.Name),
+		aws.ToString(c.Image),
+		aws.ToString(c.ImageDigest),
+		aws.ToString(c.LastStatus),
+		string(c.HealthStatus),
+		exitCode,
+		aws.ToString(c.Reason),
+		aws.ToString(c.RuntimeId),
+	}
+}
+
+// rowMap returns the row as a map keyed by the column names.
+func rowMap(columns, row []string) map[string]string {
+	m := make(map[string]string, len(columns))
+	for i, col := range columns {
+		if i < len(row) {
+			m[col] = row[i]
+		}
+	}
+	return m
+}
+
+type rowFormatterTable struct {
+	table *tablewriter.Table
+}
+
+func (f *rowFormatterTable) AddRow(row []string) {
+	f.table.Append(row)
+}
+
+func (f *rowFormatterTable) Close() {
+	f.table.Render()
+}
+
+type rowFormatterTSV struct {
+	w io.Writer
+}
+
+func (f *rowFormatterTSV) AddRow(row []string) {
+	fmt.Fprintln(f.w, strings.Join(row, "\t"))
+}
+
+func (f *rowFormatterTSV) Close() {
+}
+
+type rowFormatterJSON struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+// AddRow writes the row as a JSON object keyed by the column names.
+func (f *rowFormatterJSON) AddRow(row []string) {
+	f.enc.Encode(rowMap(f.columns, row))
+}
+
+func (f *rowFormatterJSON) Close() {
+}
+
+type rowFormatterCSV struct {
+	w *csv.Writer
+}
+
+func (f *rowFormatterCSV) AddRow(row []string) {
+	f.w.Write(row)
+}
+
+func (f *rowFormatterCSV) Close() {
+	f.w.Flush()
+}
+
+type rowFormatterMarkdown struct {
+	w io.Writer
+}
+
+func (f *rowFormatterMarkdown) AddRow(row []string) {
+	writeMarkdownRow(f.w, row)
+}
+
+func (f *rowFormatterMarkdown) Close() {
+}
+
+// rowFormatterDocument collects rows as objects keyed by the column names and writes them as a single document on Close.
+type rowFormatterDocument struct {
+	w       io.Writer
+	columns []string
+	rows    []any
+	encode  func(io.Writer, []any) error
+}
+
+func (f *rowFormatterDocument) AddRow(row []string) {
+	f.rows = append(f.rows, rowMap(f.columns, row))
+}
+
+func (f *rowFormatterDocument) Close() {
+	f.encode(f.w, f.rows)
+}
+
+// toAPIMap converts v to a map with keys in the form of the API (lowerCamelCase).
+func toAPIMap(v any) (map[string]any, error) {
 	b, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
@@ -185,24 +684,42 @@ func MarshalJSONForAPI(v any, query *gojq.Query) ([]byte, error) {
 		return nil, err
 	}
 	walkMap(m, jsonKeyForAPI)
+	return m, nil
+}
+
+// queryForAPI converts v to the form of the API and returns the first result of the query.
+// It returns false when the query yields no output.
+func queryForAPI(v any, query *gojq.Query) (any, bool, error) {
+	m, err := toAPIMap(v)
+	if err != nil {
+		return nil, false, err
+	}
 	if query == nil {
-		return json.MarshalIndent(m, "", "  ")
+		return m, true, nil
 	}
-	iter := query.Run(m)
-	for {
-		v, ok := iter.Next()
-		if !ok {
-			return nil, nil // no output(or end of stream)
-		}
-		if err, ok := v.(error); ok {
-			return nil, err
-		}
-		switch val := v.(type) {
-		case string:
-			return []byte(val), nil
-		default:
-			return json.Marshal(val) // without indent
-		}
+	r, ok := query.Run(m).Next()
+	if !ok {
+		return nil, false, nil // no output(or end of stream)
+	}
+	if err, ok := r.(error); ok {
+		return nil, false, err
+	}
+	return r, true, nil
+}
+
+func MarshalJSONForAPI(v any, query *gojq.Query) ([]byte, error) {
+	r, ok, err := queryForAPI(v, query)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if query == nil {
+		return json.MarshalIndent(r, "", "  ")
+	}
+	switch val := r.(type) {
+	case string:
+		return []byte(val), nil
+	default:
+		return json.Marshal(val) // without indent
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Songmu/flextime"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/fujiwara/ecsta"
@@ -170,6 +171,62 @@ var formatTestSuite = []struct {
 		},
 		wantFile: "testdata/tasks.queried",
 	},
+	{
+		opt: ecsta.FormatterOption{
+			Format:        "tsv",
+			HasHeader:     true,
+			Columns:       []string{"ID", "LastStatus", "Type", "Env"},
+			CustomColumns: map[string]string{"Env": `.tags[] | select(.key=="Env") | .value`},
+		},
+		wantFile: "testdata/tasks_columns.tsv",
+	},
+	{
+		opt: ecsta.FormatterOption{
+			Format:        "table",
+			HasHeader:     true,
+			Columns:       []string{"ID", "LastStatus", "Type", "Env"},
+			CustomColumns: map[string]string{"Env": `.tags[] | select(.key=="Env") | .value`},
+		},
+		wantFile: "testdata/tasks_columns.table",
+	},
+	{
+		opt: ecsta.FormatterOption{
+			Format:       "tsv",
+			AppendTaskID: true,
+			Columns:      []string{"Group", "CreatedAt"},
+		},
+		wantFile: "testdata/tasks_columns_selector.tsv",
+	},
+	{
+		opt: ecsta.FormatterOption{
+			Format:    "csv",
+			HasHeader: true,
+			WithTags:  true,
+		},
+		wantFile: "testdata/tasks_withtags.csv",
+	},
+	{
+		opt: ecsta.FormatterOption{
+			Format:        "markdown",
+			HasHeader:     true,
+			Columns:       []string{"ID", "TaskDefinition", "Group", "Note"},
+			CustomColumns: map[string]string{"Note": `"a|b\nc"`},
+		},
+		wantFile: "testdata/tasks.md",
+	},
+	{
+		opt: ecsta.FormatterOption{
+			Format: "yaml",
+			Query:  `{taskArn, lastStatus, tags}`,
+		},
+		wantFile: "testdata/tasks.yaml",
+	},
+	{
+		opt: ecsta.FormatterOption{
+			Format: "json-array",
+		},
+		wantFile: "testdata/tasks_array.json",
+	},
 }
 
 func TestFormatTasks(t *testing.T) {
@@ -191,3 +248,140 @@ func TestFormatTasks(t *testing.T) {
 		})
 	}
 }
+
+func TestRowFormatter(t *testing.T) {
+	columns := []string{"bin(1m)", "count(*)"}
+	rows := [][]string{
+		{"2023-02-10 11:00:00.000", "3"},
+		{"2023-02-10 11:01:00.000", "5"},
+	}
+	expected := map[string]string{
+		"tsv": "bin(1m)\tcount(*)\n2023-02-10 11:00:00.000\t3\n2023-02-10 11:01:00.000\t5\n",
+		"json": `{"bin(1m)":"2023-02-10 11:00:00.000","count(*)":"3"}` + "\n" +
+			`{"bin(1m)":"2023-02-10 11:01:00.000","count(*)":"5"}` + "\n",
+		"csv": "bin(1m),count(*)\n2023-02-10 11:00:00.000,3\n2023-02-10 11:01:00.000,5\n",
+		"markdown": "| bin(1m) | count(*) |\n| --- | --- |\n" +
+			"| 2023-02-10 11:00:00.000 | 3 |\n| 2023-02-10 11:01:00.000 | 5 |\n",
+		"yaml": "- bin(1m): \"2023-02-10 11:00:00.000\"\n  count(*): \"3\"\n" +
+			"- bin(1m): \"2023-02-10 11:01:00.000\"\n  count(*): \"5\"\n",
+		"json-array": "[\n  {\n    \"bin(1m)\": \"2023-02-10 11:00:00.000\",\n    \"count(*)\": \"3\"\n  },\n" +
+			"  {\n    \"bin(1m)\": \"2023-02-10 11:01:00.000\",\n    \"count(*)\": \"5\"\n  }\n]\n",
+	}
+	for format, want := range expected {
+		t.Run(format, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			f, err := ecsta.NewRowFormatter(b, format, columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows {
+				f.AddRow(row)
+			}
+			f.Close()
+			if diff := cmp.Diff(want, b.String()); diff != "" {
+				t.Errorf("unexpected output: %s", diff)
+			}
+		})
+	}
+	if _, err := ecsta.NewRowFormatter(&bytes.Buffer{}, "unknown", columns); err == nil {
+		t.Error("expected an error for unknown format")
+	}
+}
+
+func TestFormatTasksUnknownColumn(t *testing.T) {
+	_, err := ecsta.NewTaskFormatter(new(bytes.Buffer), ecsta.FormatterOption{
+		Format:  "table",
+		Columns: []string{"ID", "Foo"},
+	})
+	if err == nil {
+		t.Error("expected an error for unknown column")
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	restore := flextime.Fix(time.Date(2023, 1, 1, 0, 3, 0, 0, time.UTC))
+	defer restore()
+	cases := []struct {
+		opt  ecsta.FormatterOption
+		want string
+	}{
+		{
+			opt: ecsta.FormatterOption{
+				Template: `{{.TaskArn | name}} {{.LastStatus}} {{.CreatedAt | ago}}`,
+			},
+			want: "045a0639-1dc5-4d17-8101-2dd3fd339e91 PENDING 365d ago\n" +
+				"8f431e68-a57d-41db-ae8d-5eb700a134dc PENDING 3m ago\n",
+		},
+		{
+			opt: ecsta.FormatterOption{
+				Template:     `{{tag "Env" .}} {{.Tags | tag "Name"}} {{(container "db" .).Name}} [{{with (container "none" .).Name}}{{.}}{{end}}]`,
+				AppendTaskID: true,
+			},
+			want: "045a0639-1dc5-4d17-8101-2dd3fd339e91\tprod task-name db []\n" +
+				"8f431e68-a57d-41db-ae8d-5eb700a134dc\tdev task-name db []\n",
+		},
+	}
+	for _, c := range cases {
+		c.opt.Format = "template"
+		buf := new(bytes.Buffer)
+		f, err := ecsta.NewTaskFormatter(buf, c.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, task := range formatTestTasks {
+			f.AddTask(task)
+		}
+		f.Close()
+		if diff := cmp.Diff(c.want, buf.String()); diff != "" {
+			t.Errorf("unexpected output for %s: %s", c.opt.Template, diff)
+		}
+	}
+	if _, err := ecsta.NewTaskFormatter(new(bytes.Buffer), ecsta.FormatterOption{Format: "template", Template: "{{.TaskArn"}); err == nil {
+		t.Error("expected an error for invalid template")
+	}
+}
+
+func TestContainerFormatter(t *testing.T) {
+	task := types.Task{
+		TaskArn:    aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster-name/045a0639-1dc5-4d17-8101-2dd3fd339e91"),
+		ClusterArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/cluster-name"),
+		Containers: []types.Container{
+			{
+				Name:         aws.String("web"),
+				Image:        aws.String("nginx:latest"),
+				ImageDigest:  aws.String("sha256:0123"),
+				LastStatus:   aws.String("RUNNING"),
+				HealthStatus: types.HealthStatusHealthy,
+				RuntimeId:    aws.String("045a0639-web"),
+			},
+			{
+				Name:       aws.String("init"),
+				Image:      aws.String("busybox"),
+				LastStatus: aws.String("STOPPED"),
+				ExitCode:   aws.Int32(1),
+				Reason:     aws.String("Essential container exited"),
+			},
+		},
+	}
+	expected := map[string]string{
+		"tsv": "Cluster\tTaskID\tName\tImage\tImageDigest\tLastStatus\tHealthStatus\tExitCode\tReason\tRuntimeID\n" +
+			"cluster-name\t045a0639-1dc5-4d17-8101-2dd3fd339e91\tweb\tnginx:latest\tsha256:0123\tRUNNING\tHEALTHY\t\t\t045a0639-web\n" +
+			"cluster-name\t045a0639-1dc5-4d17-8101-2dd3fd339e91\tinit\tbusybox\t\tSTOPPED\t\t1\tEssential container exited\t\n",
+		"json": `{"Cluster":"cluster-name","ExitCode":"","HealthStatus":"HEALTHY","Image":"nginx:latest","ImageDigest":"sha256:0123","LastStatus":"RUNNING","Name":"web","Reason":"","RuntimeID":"045a0639-web","TaskID":"045a0639-1dc5-4d17-8101-2dd3fd339e91"}` + "\n" +
+			`{"Cluster":"cluster-name","ExitCode":"1","HealthStatus":"","Image":"busybox","ImageDigest":"","LastStatus":"STOPPED","Name":"init","Reason":"Essential container exited","RuntimeID":"","TaskID":"045a0639-1dc5-4d17-8101-2dd3fd339e91"}` + "\n",
+	}
+	for format, want := range expected {
+		t.Run(format, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			f, err := ecsta.NewContainerFormatter(buf, ecsta.FormatterOption{Format: format, WithCluster: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.AddTask(task)
+			f.Close()
+			if diff := cmp.Diff(want, buf.String()); diff != "" {
+				t.Errorf("unexpected output: %s", diff)
+			}
+		})
+	}
+}
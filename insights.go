@@ -0,0 +1,210 @@
+package ecsta
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/samber/lo"
+)
+
+// LogsCommand is the logs command. Showing log messages is the default subcommand.
+type LogsCommand struct {
+	Show     *LogsOption         `cmd:"" default:"withargs" help:"Show log messages of a task (default)"`
+	Insights *LogsInsightsOption `cmd:"" help:"Run a CloudWatch Logs Insights query for logs of a task"`
+}
+
+type LogsInsightsOption struct {
+	Query     string        `help:"CloudWatch Logs Insights query. a filter for the log streams of the task is prepended" required:""`
+	Limit     int32         `help:"maximum number of results" default:"1000"`
+	ID        string        `help:"task ID"`
+	StartTime string        `help:"a start time of logs" short:"s"`
+	EndTime   string        `help:"an end time of logs. defaults to start-time + duration"`
+	Since     time.Duration `help:"query logs since the duration ago (e.g. 2h)"`
+	Duration  time.Duration `help:"log timestamps duration" short:"d" default:"1h"`
+	Container string        `help:"container name"`
+	Family    *string       `help:"task definition family name"`
+	Service   *string       `help:"ECS service name. When combined with --family, tasks of other services sharing the family are excluded."`
+	AllTasks  bool          `help:"query logs of all tasks of the service or family, including recently stopped tasks"`
+}
+
+// insightsMaxLogGroups is the maximum number of log groups in a CloudWatch Logs Insights query.
+const insightsMaxLogGroups = 50
+
+// insightsPollInterval is the interval to poll results of CloudWatch Logs Insights queries.
+var insightsPollInterval = time.Second
+
+func (app *Ecsta) RunLogsInsights(ctx context.Context, opt *LogsInsightsOption) error {
+	if opt.AllTasks {
+		if opt.ID != "" {
+			return fmt.Errorf("all-tasks and id cannot be specified at the same time")
+		}
+		if opt.Service == nil && opt.Family == nil {
+			return fmt.Errorf("all-tasks requires service or family")
+		}
+	}
+	if err := app.SetCluster(ctx); err != nil {
+		return err
+	}
+	startTime, endTime, err := (&LogsOption{
+		StartTime: opt.StartTime,
+		EndTime:   opt.EndTime,
+		Since:     opt.Since,
+		Duration:  opt.Duration,
+	}).ResolveTimestamps()
+	if err != nil {
+		return err
+	}
+
+	var streams []logStream
+	if opt.AllTasks {
+		streams, err = app.allTasksLogStreams(ctx, opt, startTime, endTime)
+		if err != nil {
+			return err
+		}
+	} else {
+		task, err := app.findTask(ctx, &optionFindTask{id: opt.ID, family: opt.Family, service: opt.Service})
+		if err != nil {
+			return fmt.Errorf("failed to select tasks: %w", err)
+		}
+		td, err := app.describeTaskDefinition(ctx, task)
+		if err != nil {
+			return err
+		}
+		var notes []string
+		streams, _, notes = taskLogStreams(task, td, opt.Container)
+		for _, note := range notes {
+			slog.Info("logs are not queried", "container", note)
+		}
+	}
+	if len(streams) == 0 {
+		return fmt.Errorf("no logs found in CloudWatch Logs")
+	}
+	groups := lo.Uniq(lo.Map(streams, func(s logStream, _ int) string { return s.group }))
+	if len(groups) > insightsMaxLogGroups {
+		return fmt.Errorf("too many log groups to query: %d (max %d)", len(groups), insightsMaxLogGroups)
+	}
+	query := insightsQueryString(streams, opt.Query)
+	slog.Debug("starting query", "query", query, "log_groups", groups)
+
+	res, err := app.logs.StartQuery(ctx, &cloudwatchlogs.StartQueryInput{
+		LogGroupNames: groups,
+		QueryString:   &query,
+		StartTime:     aws.Int64(startTime.Unix()),
+		EndTime:       aws.Int64(endTime.Unix()),
+		Limit:         aws.Int32(opt.Limit),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start query: %w", err)
+	}
+	out, err := app.waitQueryResults(ctx, aws.ToString(res.QueryId))
+	if err != nil {
+		return err
+	}
+	if st := out.Statistics; st != nil {
+		slog.Info("query completed", "records_matched", st.RecordsMatched, "records_scanned", st.RecordsScanned, "bytes_scanned", st.BytesScanned)
+	}
+	columns, rows := insightsResultRows(out.Results)
+	f, err := newRowFormatter(app.w, app.Config.Output, columns)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		f.AddRow(row)
+	}
+	f.Close()
+	return nil
+}
+
+// allTasksLogStreams returns the log streams of all tasks of the service or family in the time range.
+func (app *Ecsta) allTasksLogStreams(ctx context.Context, opt *LogsInsightsOption, startTime, endTime time.Time) ([]logStream, error) {
+	tasks, err := app.listTasks(ctx, app.cluster, &optionListTasks{
+		family:  opt.Family,
+		service: opt.Service,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	var streams []logStream
+	taskDefs := map[string]*types.TaskDefinition{}
+	for _, task := range tasks {
+		if !taskInLogsRange(task, startTime, endTime) {
+			continue
+		}
+		tdArn := aws.ToString(task.TaskDefinitionArn)
+		td, ok := taskDefs[tdArn]
+		if !ok {
+			td, err = app.describeTaskDefinition(ctx, task)
+			if err != nil {
+				return nil, err
+			}
+			taskDefs[tdArn] = td
+		}
+		ss, _, _ := taskLogStreams(task, td, opt.Container)
+		streams = append(streams, ss...)
+	}
+	return streams, nil
+}
+
+// waitQueryResults polls the results of the query until it completes.
+// The query is stopped when ctx is canceled.
+func (app *Ecsta) waitQueryResults(ctx context.Context, queryID string) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	for {
+		if err := sleepWithContext(ctx, insightsPollInterval); err != nil {
+			app.logs.StopQuery(context.Background(), &cloudwatchlogs.StopQueryInput{QueryId: &queryID})
+			return nil, err
+		}
+		out, err := app.logs.GetQueryResults(ctx, &cloudwatchlogs.GetQueryResultsInput{QueryId: &queryID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query results: %w", err)
+		}
+		switch out.Status {
+		case logsTypes.QueryStatusComplete:
+			return out, nil
+		case logsTypes.QueryStatusScheduled, logsTypes.QueryStatusRunning:
+			slog.Debug("waiting for query results", "query_id", queryID, "status", out.Status)
+		default:
+			return nil, fmt.Errorf("query %s is %s", queryID, out.Status)
+		}
+	}
+}
+
+// insightsQueryString prepends a filter for the log streams to the query.
+func insightsQueryString(streams []logStream, query string) string {
+	names := lo.Uniq(lo.Map(streams, func(s logStream, _ int) string { return fmt.Sprintf("%q", s.stream) }))
+	return fmt.Sprintf("filter @logStream in [%s]\n| %s", strings.Join(names, ", "), query)
+}
+
+// insightsResultRows converts the query results to rows.
+// Columns are the fields in the order of appearance, except for @ptr.
+func insightsResultRows(results [][]logsTypes.ResultField) ([]string, [][]string) {
+	var columns []string
+	index := map[string]int{}
+	for _, result := range results {
+		for _, f := range result {
+			field := aws.ToString(f.Field)
+			if _, ok := index[field]; ok || field == "@ptr" {
+				continue
+			}
+			index[field] = len(columns)
+			columns = append(columns, field)
+		}
+	}
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		row := make([]string, len(columns))
+		for _, f := range result {
+			if i, ok := index[aws.ToString(f.Field)]; ok {
+				row[i] = aws.ToString(f.Value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
@@ -1,45 +1,467 @@
 package ecsta
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/itchyny/gojq"
+	"github.com/samber/lo"
 )
 
 type ListOption struct {
-	Family     *string           `help:"Task definition family" short:"f"`
-	Service    *string           `help:"Service name. When combined with --family, tasks of other services sharing the family are excluded." short:"s"`
-	OutputTags bool              `help:"Output tags of tasks"`
-	Tags       map[string]string `help:"Show only tasks that have specified tags" mapsep:","`
+	Family      *string           `help:"Task definition family" short:"f"`
+	Service     *string           `help:"Service name. When combined with --family, tasks of other services sharing the family are excluded." short:"s"`
+	OutputTags  bool              `help:"Output tags of tasks"`
+	Containers  bool              `help:"show a row per container of tasks"`
+	Summary     bool              `help:"show the number of tasks by the service or family, with task definitions and launch types"`
+	Tags        map[string]string `help:"Show only tasks that have specified tags" mapsep:","`
+	AllClusters bool              `help:"list tasks in all clusters. the Cluster column is added"`
+	Regions     []string          `help:"list tasks in the regions (comma separated). the Region column is added" sep:","`
+	Profiles    []string          `help:"list tasks with the AWS profiles (comma separated). the Profile column is added" sep:","`
+	Status      string            `help:"desired status of tasks (running, stopped, all)" enum:"running,stopped,all" default:"all"`
+	LaunchType  string            `help:"launch type of tasks (EC2, FARGATE, EXTERNAL)"`
+	StartedBy   string            `help:"show only tasks started by the value"`
+	OlderThan   time.Duration     `help:"show only tasks created before the duration ago"`
+	NewerThan   time.Duration     `help:"show only tasks created within the duration"`
+	SortBy      string            `help:"sort tasks by (createdAt, status, taskDefinition). API order by default" enum:"none,createdAt,status,taskDefinition" default:"none"`
+	Columns     []string          `help:"columns to show (comma separated). built-in columns or custom columns defined in the configuration file" sep:","`
+	Watch       bool              `help:"watch tasks. refresh the list on the interval and show status transitions" short:"w"`
+	Interval    time.Duration     `help:"refresh interval of --watch" default:"5s"`
 }
 
 func (app *Ecsta) RunList(ctx context.Context, opt *ListOption) error {
-	if err := app.SetCluster(ctx); err != nil {
+	if opt.Containers && len(opt.Columns) > 0 {
+		return fmt.Errorf("--columns cannot be used with --containers")
+	}
+	if opt.Summary && (opt.Containers || len(opt.Columns) > 0) {
+		return fmt.Errorf("--containers and --columns cannot be used with --summary")
+	}
+	multi := len(opt.Regions) > 0 || len(opt.Profiles) > 0
+	if multi && !opt.AllClusters && app.cluster == "" {
+		return fmt.Errorf("--regions and --profiles require --cluster or --all-clusters")
+	}
+	if !opt.AllClusters {
+		if err := app.SetCluster(ctx); err != nil {
+			return err
+		}
+	}
+	targets, err := app.listTargets(ctx, opt)
+	if err != nil {
 		return err
 	}
-	tasks, err := app.listTasks(ctx, &optionListTasks{
-		family:  opt.Family,
-		service: opt.Service,
-		tags:    opt.Tags,
-	})
+	if opt.Watch {
+		return app.watchList(ctx, targets, opt)
+	}
+	list, err := app.listTasksForList(ctx, targets, opt)
 	if err != nil {
-		return fmt.Errorf("failed to list tasks in cluster %s: %w", app.cluster, err)
+		return err
+	}
+	return app.printTasks(app.w, list, opt)
+}
+
+// taskList is a result of listing tasks with the information not included in the tasks.
+type taskList struct {
+	tasks      []types.Task
+	profiles   map[string]string                    // task ARN -> profile name
+	interfaces map[string]ec2Types.NetworkInterface // ENI ID -> network interface by the EC2 API
+}
+
+// listColumns returns the columns specified by the option or the configuration.
+func (app *Ecsta) listColumns(opt *ListOption) []string {
+	if len(opt.Columns) > 0 {
+		return opt.Columns
+	}
+	return parseColumns(app.Config.Columns)
+}
+
+// listTargets returns the apps for each combination of the regions and the profiles.
+// The current region and credentials are used when they are not specified.
+func (app *Ecsta) listTargets(ctx context.Context, opt *ListOption) ([]*Ecsta, error) {
+	if len(opt.Regions) == 0 && len(opt.Profiles) == 0 {
+		return []*Ecsta{app}, nil
+	}
+	regions := opt.Regions
+	if len(regions) == 0 {
+		regions = []string{app.region}
+	}
+	profiles := opt.Profiles
+	if len(profiles) == 0 {
+		profiles = []string{""}
+	}
+	var targets []*Ecsta
+	for _, profile := range profiles {
+		for _, region := range regions {
+			t, err := app.forTarget(ctx, region, profile)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// listTasksForList lists tasks in the targets concurrently.
+// When profiles share an AWS account, the same tasks are listed once with the first profile.
+// Network interfaces are described by the EC2 API only when the columns require them.
+func (app *Ecsta) listTasksForList(ctx context.Context, targets []*Ecsta, opt *ListOption) (*taskList, error) {
+	describeENI := !opt.Containers && !opt.Summary && needsEC2NetworkColumns(app.listColumns(opt))
+	results := make([][]types.Task, len(targets))
+	interfaces := make([]map[string]ec2Types.NetworkInterface, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = target.listTasksInTarget(ctx, opt)
+			if errs[i] != nil && len(targets) > 1 {
+				errs[i] = fmt.Errorf("region %s profile %q: %w", target.region, target.profile, errs[i])
+			}
+			if errs[i] == nil && describeENI {
+				var err error
+				if interfaces[i], err = target.describeTaskNetworkInterfaces(ctx, results[i]); err != nil {
+					slog.Warn("network interfaces are not described", "region", target.region, "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	list := &taskList{
+		profiles:   map[string]string{},
+		interfaces: map[string]ec2Types.NetworkInterface{},
+	}
+	for i, target := range targets {
+		for _, task := range results[i] {
+			if _, ok := list.profiles[aws.ToString(task.TaskArn)]; !ok {
+				list.profiles[aws.ToString(task.TaskArn)] = target.profile
+			}
+		}
+		maps.Copy(list.interfaces, interfaces[i])
+	}
+	tasks := lo.UniqBy(slices.Concat(results...), func(task types.Task) string {
+		return aws.ToString(task.TaskArn)
+	})
+	tasks = filterTasksByAge(tasks, opt.OlderThan, opt.NewerThan, flextime.Now())
+	sortTasks(tasks, opt.SortBy)
+	list.tasks = tasks
+	return list, nil
+}
+
+// listTasksInTarget lists tasks in the cluster or all clusters of the app.
+func (app *Ecsta) listTasksInTarget(ctx context.Context, opt *ListOption) ([]types.Task, error) {
+	lopt := &optionListTasks{
+		family:     opt.Family,
+		service:    opt.Service,
+		tags:       opt.Tags,
+		launchType: types.LaunchType(strings.ToUpper(opt.LaunchType)),
+		startedBy:  optional(opt.StartedBy),
+	}
+	switch opt.Status {
+	case "running":
+		lopt.statuses = []types.DesiredStatus{types.DesiredStatusRunning}
+	case "stopped":
+		lopt.statuses = []types.DesiredStatus{types.DesiredStatusStopped}
+	}
+	var tasks []types.Task
+	if opt.AllClusters {
+		clusters, err := app.listClusters(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list clusters: %w", err)
+		}
+		tasks, err = app.listTasksInClusters(ctx, clusters, lopt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		tasks, err = app.listTasks(ctx, app.cluster, lopt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tasks in cluster %s: %w", app.cluster, err)
+		}
+	}
+	return tasks, nil
+}
+
+// filterTasksByAge returns tasks created before olderThan ago and within newerThan. zero means no limit.
+func filterTasksByAge(tasks []types.Task, olderThan, newerThan time.Duration, now time.Time) []types.Task {
+	if olderThan == 0 && newerThan == 0 {
+		return tasks
+	}
+	return lo.Filter(tasks, func(task types.Task, _ int) bool {
+		if task.CreatedAt == nil {
+			return false
+		}
+		age := now.Sub(*task.CreatedAt)
+		if olderThan != 0 && age < olderThan {
+			return false
+		}
+		if newerThan != 0 && age > newerThan {
+			return false
+		}
+		return true
+	})
+}
+
+// taskStatusOrder is the order of the lifecycle of tasks.
+var taskStatusOrder = []string{
+	"PROVISIONING",
+	"PENDING",
+	"ACTIVATING",
+	"RUNNING",
+	"DEACTIVATING",
+	"STOPPING",
+	"DEPROVISIONING",
+	"STOPPED",
+	"DELETED",
+}
+
+// sortTasks sorts tasks in place. Tasks in the same order are sorted by the creation time.
+func sortTasks(tasks []types.Task, by string) {
+	createdAt := func(t types.Task) time.Time { return aws.ToTime(t.CreatedAt) }
+	var cmpFunc func(a, b types.Task) int
+	switch by {
+	case "createdAt":
+		cmpFunc = func(a, b types.Task) int { return createdAt(a).Compare(createdAt(b)) }
+	case "status":
+		cmpFunc = func(a, b types.Task) int {
+			return cmp.Or(
+				cmp.Compare(taskStatusIndex(a), taskStatusIndex(b)),
+				createdAt(a).Compare(createdAt(b)),
+			)
+		}
+	case "taskDefinition":
+		cmpFunc = func(a, b types.Task) int {
+			return cmp.Or(
+				compareTaskDefinition(aws.ToString(a.TaskDefinitionArn), aws.ToString(b.TaskDefinitionArn)),
+				createdAt(a).Compare(createdAt(b)),
+			)
+		}
+	default:
+		return
+	}
+	slices.SortStableFunc(tasks, cmpFunc)
+}
+
+func taskStatusIndex(task types.Task) int {
+	if i := slices.Index(taskStatusOrder, aws.ToString(task.LastStatus)); i >= 0 {
+		return i
+	}
+	return len(taskStatusOrder)
+}
+
+// compareTaskDefinition compares task definitions by the family and the revision number.
+func compareTaskDefinition(a, b string) int {
+	af, ar, _ := strings.Cut(arnToName(a), ":")
+	bf, br, _ := strings.Cut(arnToName(b), ":")
+	an, _ := strconv.Atoi(ar)
+	bn, _ := strconv.Atoi(br)
+	return cmp.Or(cmp.Compare(af, bf), cmp.Compare(an, bn))
+}
+
+func (app *Ecsta) printTasks(w io.Writer, list *taskList, opt *ListOption) error {
+	if opt.Summary {
+		return app.printSummary(w, list, opt)
 	}
 	fopt := formatterOption{
-		Format:    app.Config.Output,
-		HasHeader: true,
-		WithTags:  opt.OutputTags,
+		Format:        app.Config.Output,
+		HasHeader:     true,
+		WithTags:      opt.OutputTags,
+		WithCluster:   opt.AllClusters,
+		WithRegion:    len(opt.Regions) > 0,
+		WithProfile:   len(opt.Profiles) > 0,
+		Profiles:      list.profiles,
+		Interfaces:    list.interfaces,
+		Columns:       app.listColumns(opt),
+		CustomColumns: app.Config.CustomColumns,
 	}
-	if query := app.Config.TaskFormatQuery; query != "" {
-		fopt.Format = "json"
-		fopt.Query = query
+	var f taskFormatter
+	var err error
+	if opt.Containers {
+		f, err = newContainerFormatter(w, fopt)
+	} else {
+		app.applyTaskFormat(&fopt)
+		f, err = newTaskFormatter(w, fopt)
 	}
-	f, err := newTaskFormatter(app.w, fopt)
 	if err != nil {
 		return fmt.Errorf("failed to create task formatter: %w", err)
 	}
-	for _, task := range tasks {
+	for _, task := range list.tasks {
 		f.AddTask(task)
 	}
 	f.Close()
 	return nil
 }
+
+// listWatchTransitions is the number of recent status transitions shown in --watch mode.
+const listWatchTransitions = 10
+
+// watchList refreshes the list of tasks on the interval.
+// On a terminal, the list is redrawn in place with recent status transitions.
+// Otherwise, only new or changed tasks are written as JSON lines.
+func (app *Ecsta) watchList(ctx context.Context, targets []*Ecsta, opt *ListOption) error {
+	tty := app.w == io.Writer(os.Stdout) && isTerminal(os.Stdout)
+	query := app.Config.TaskFormatQuery
+	if query == "" {
+		query = "." // compact JSON
+	}
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return fmt.Errorf("failed to parse query: %w", err)
+	}
+	var tf taskFormatter // lines of changed tasks by the template
+	if tmpl := app.Config.TaskFormat; tmpl != "" {
+		if tf, err = newTaskFormatterTemplate(app.w, formatterOption{Template: tmpl}); err != nil {
+			return err
+		}
+	}
+	watcher := newTaskWatcher()
+	var transitions []taskTransition
+	for {
+		list, err := app.listTasksForList(ctx, targets, opt)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Warn("failed to list tasks", "error", err)
+		} else {
+			now := flextime.Now()
+			changed, trs := watcher.update(list.tasks, now)
+			transitions = append(transitions, trs...)
+			if len(transitions) > listWatchTransitions {
+				transitions = transitions[len(transitions)-listWatchTransitions:]
+			}
+			if tty {
+				if err := app.redrawList(list, transitions, opt, now); err != nil {
+					return err
+				}
+			} else if tf != nil {
+				for _, task := range changed {
+					tf.AddTask(task)
+				}
+			} else {
+				for _, task := range changed {
+					b, err := MarshalJSONForAPI(task, q)
+					if err != nil {
+						return err
+					}
+					if b != nil {
+						fmt.Fprintln(app.w, string(b))
+					}
+				}
+			}
+		}
+		if err := sleepWithContext(ctx, opt.Interval); err != nil {
+			return nil
+		}
+	}
+}
+
+// redrawList clears the terminal and draws the list of tasks and recent transitions.
+func (app *Ecsta) redrawList(list *taskList, transitions []taskTransition, opt *ListOption, now time.Time) error {
+	var buf bytes.Buffer
+	target := "cluster " + app.cluster
+	if opt.AllClusters {
+		target = "all clusters"
+	}
+	fmt.Fprintf(&buf, "Every %s: tasks in %s\t%s\n\n", opt.Interval, target, now.Format(time.RFC3339))
+	if err := app.printTasks(&buf, list, opt); err != nil {
+		return err
+	}
+	if len(transitions) > 0 {
+		fmt.Fprintln(&buf, "\nRecent transitions:")
+		for _, tr := range transitions {
+			fmt.Fprintln(&buf, tr.String())
+		}
+	}
+	// move the cursor to home and clear the screen
+	io.WriteString(app.w, "\x1b[H\x1b[2J")
+	_, err := buf.WriteTo(app.w)
+	return err
+}
+
+// taskWatcher detects changes of tasks between refreshes.
+type taskWatcher struct {
+	statuses map[string]string // task ID -> last status
+	started  bool
+}
+
+type taskTransition struct {
+	at   time.Time
+	id   string
+	from string // empty for new tasks
+	to   string // taskGone for tasks no longer listed
+}
+
+// taskGone is the status of a task that is no longer in the list (e.g. stopped with --status running).
+const taskGone = "(gone)"
+
+func (tr taskTransition) String() string {
+	from := tr.from
+	if from == "" {
+		from = "(new)"
+	}
+	color := "33" // yellow
+	switch tr.to {
+	case "RUNNING":
+		color = "32" // green
+	case "DEACTIVATING", "STOPPING", "DEPROVISIONING", "STOPPED", taskGone:
+		color = "31" // red
+	}
+	return fmt.Sprintf("%s %s %s → \x1b[%sm%s\x1b[0m", tr.at.In(time.Local).Format(time.TimeOnly), tr.id, from, color, tr.to)
+}
+
+func newTaskWatcher() *taskWatcher {
+	return &taskWatcher{statuses: map[string]string{}}
+}
+
+// update returns new or changed tasks, and status transitions since the last update.
+// Tasks found by the first update are not reported as transitions.
+// Tasks no longer in the list are reported as transitions to taskGone and forgotten.
+func (w *taskWatcher) update(tasks []types.Task, now time.Time) ([]types.Task, []taskTransition) {
+	var changed []types.Task
+	var transitions []taskTransition
+	listed := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		id := arnToName(*task.TaskArn)
+		listed[id] = true
+		status := aws.ToString(task.LastStatus)
+		prev, ok := w.statuses[id]
+		if ok && prev == status {
+			continue
+		}
+		w.statuses[id] = status
+		changed = append(changed, task)
+		if w.started {
+			transitions = append(transitions, taskTransition{at: now, id: id, from: prev, to: status})
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(w.statuses)) {
+		if listed[id] {
+			continue
+		}
+		transitions = append(transitions, taskTransition{at: now, id: id, from: w.statuses[id], to: taskGone})
+		delete(w.statuses, id)
+	}
+	w.started = true
+	return changed, transitions
+}
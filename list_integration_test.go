@@ -0,0 +1,257 @@
+package ecsta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeECSServer is a fake ECS API server. Each cluster has tasks named "<cluster>-<n>".
+type fakeECSServer struct {
+	region   string         // us-east-1 by default
+	account  string         // 123456789012 by default
+	clusters map[string]int // cluster name -> number of tasks
+	fail     string         // cluster name to fail ListTasks
+	inFlight atomic.Int32
+	maxCalls atomic.Int32
+
+	mu        sync.Mutex
+	listTasks []map[string]any // request bodies of ListTasks
+}
+
+func (s *fakeECSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Cluster string   `json:"cluster"`
+		Tasks   []string `json:"tasks"`
+	}
+	b, _ := io.ReadAll(r.Body)
+	json.Unmarshal(b, &req)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	region, account := s.region, s.account
+	if region == "" {
+		region = "us-east-1"
+	}
+	if account == "" {
+		account = "123456789012"
+	}
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonEC2ContainerServiceV20141113.") {
+	case "ListClusters":
+		var arns []string
+		for name := range s.clusters {
+			arns = append(arns, fmt.Sprintf(`"arn:aws:ecs:%s:%s:cluster/%s"`, region, account, name))
+		}
+		fmt.Fprintf(w, `{"clusterArns":[%s]}`, strings.Join(arns, ","))
+	case "ListTasks":
+		var body map[string]any
+		json.Unmarshal(b, &body)
+		s.mu.Lock()
+		s.listTasks = append(s.listTasks, body)
+		s.mu.Unlock()
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for {
+			m := s.maxCalls.Load()
+			if n <= m || s.maxCalls.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		cluster := arnToName(req.Cluster)
+		if cluster == s.fail {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"AccessDeniedException","message":"not authorized"}`)
+			return
+		}
+		if strings.Contains(string(b), "STOPPED") {
+			fmt.Fprint(w, `{"taskArns":[]}`)
+			return
+		}
+		var arns []string
+		for i := range s.clusters[cluster] {
+			arns = append(arns, fmt.Sprintf(`"arn:aws:ecs:%s:%s:task/%s/%s-%d"`, region, account, cluster, cluster, i))
+		}
+		fmt.Fprintf(w, `{"taskArns":[%s]}`, strings.Join(arns, ","))
+	case "DescribeTasks":
+		cluster := arnToName(req.Cluster)
+		var tasks []string
+		for _, arn := range req.Tasks {
+			// the first task of each cluster is started by a service
+			startedBy := "manual"
+			if strings.HasSuffix(arn, "-0") {
+				startedBy = "ecs-svc/1"
+			}
+			tasks = append(tasks, fmt.Sprintf(`{"taskArn":%q,"clusterArn":"arn:aws:ecs:%s:%s:cluster/%s","startedBy":%q}`, arn, region, account, cluster, startedBy))
+		}
+		fmt.Fprintf(w, `{"tasks":[%s]}`, strings.Join(tasks, ","))
+	default:
+		http.Error(w, "unknown target", http.StatusBadRequest)
+	}
+}
+
+func newFakeECSApp(t *testing.T, h http.Handler) *Ecsta {
+	t.Helper()
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	client := ecs.New(ecs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(ts.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	return &Ecsta{ecs: client, Config: &Config{}}
+}
+
+func TestListTasksInClusters(t *testing.T) {
+	s := &fakeECSServer{clusters: map[string]int{"a": 2, "b": 0, "c": 1, "d": 1, "e": 3, "f": 1}}
+	app := newFakeECSApp(t, s)
+	clusters := []string{"a", "b", "c", "d", "e", "f"}
+	tasks, err := app.listTasksInClusters(t.Context(), clusters, &optionListTasks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, arnToName(aws.ToString(task.ClusterArn))+"/"+arnToName(aws.ToString(task.TaskArn)))
+	}
+	expected := []string{"a/a-0", "a/a-1", "c/c-0", "d/d-0", "e/e-0", "e/e-1", "e/e-2", "f/f-0"}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected tasks: %s", diff)
+	}
+	if m := s.maxCalls.Load(); m > int32(listTasksConcurrency) {
+		t.Errorf("too many concurrent calls: %d", m)
+	}
+}
+
+func TestListTasksInClustersError(t *testing.T) {
+	s := &fakeECSServer{clusters: map[string]int{"a": 1, "b": 1}, fail: "b"}
+	app := newFakeECSApp(t, s)
+	_, err := app.listTasksInClusters(t.Context(), []string{"a", "b"}, &optionListTasks{})
+	if err == nil || !strings.Contains(err.Error(), "failed to list tasks in cluster b") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunListAllClusters(t *testing.T) {
+	s := &fakeECSServer{clusters: map[string]int{"a": 1, "b": 1}}
+	app := newFakeECSApp(t, s)
+	app.Config.Output = "tsv"
+	buf := &strings.Builder{}
+	app.w = buf
+	if err := app.RunList(t.Context(), &ListOption{AllClusters: true, Status: "all", SortBy: "none", Columns: []string{"ID"}}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "Cluster\tID" {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	got := lines[1:]
+	if len(got) != 2 {
+		t.Fatalf("unexpected lines: %q", got)
+	}
+	for _, line := range got {
+		cluster, id, _ := strings.Cut(line, "\t")
+		if !strings.HasPrefix(id, cluster+"-") {
+			t.Errorf("unexpected line: %q", line)
+		}
+	}
+}
+
+func TestListTasksForListTargets(t *testing.T) {
+	accounts := map[string]string{"prod": "111111111111", "stg": "222222222222"}
+	newTarget := func(region, profile string, clusters map[string]int) *Ecsta {
+		app := newFakeECSApp(t, &fakeECSServer{region: region, account: accounts[profile], clusters: clusters})
+		app.region = region
+		app.profile = profile
+		app.cluster = "web"
+		return app
+	}
+	targets := []*Ecsta{
+		newTarget("ap-northeast-1", "prod", map[string]int{"web": 2}),
+		newTarget("us-east-1", "prod", map[string]int{"web": 1}),
+		newTarget("ap-northeast-1", "stg", map[string]int{"web": 1, "batch": 1}),
+	}
+	opt := &ListOption{
+		Status:   "all",
+		SortBy:   "none",
+		Regions:  []string{"ap-northeast-1", "us-east-1"},
+		Profiles: []string{"prod", "stg"},
+		Columns:  []string{"ID"},
+	}
+	app := &Ecsta{Config: &Config{Output: "tsv"}}
+	list, err := app.listTasksForList(t.Context(), targets, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &strings.Builder{}
+	if err := app.printTasks(buf, list, opt); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"Profile\tRegion\tID",
+		"prod\tap-northeast-1\tweb-0",
+		"prod\tap-northeast-1\tweb-1",
+		"prod\tus-east-1\tweb-0",
+		"stg\tap-northeast-1\tweb-0",
+	}, "\n") + "\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected output: %s", diff)
+	}
+}
+
+func TestListTasksForListSharedAccount(t *testing.T) {
+	var targets []*Ecsta
+	for _, profile := range []string{"admin", "readonly"} {
+		app := newFakeECSApp(t, &fakeECSServer{clusters: map[string]int{"web": 1}})
+		app.profile = profile
+		app.cluster = "web"
+		targets = append(targets, app)
+	}
+	list, err := targets[0].listTasksForList(t.Context(), targets, &ListOption{Status: "all", SortBy: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.tasks) != 1 {
+		t.Fatalf("unexpected number of tasks: %d", len(list.tasks))
+	}
+	if p := list.profiles[aws.ToString(list.tasks[0].TaskArn)]; p != "admin" {
+		t.Errorf("unexpected profile: %s", p)
+	}
+}
+
+func TestListTasksStartedBy(t *testing.T) {
+	s := &fakeECSServer{clusters: map[string]int{"web": 3}}
+	app := newFakeECSApp(t, s)
+	tasks, err := app.listTasks(t.Context(), "web", &optionListTasks{
+		family:     aws.String("web"),
+		launchType: types.LaunchTypeFargate,
+		startedBy:  aws.String("ecs-svc/1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || arnToName(aws.ToString(tasks[0].TaskArn)) != "web-0" {
+		t.Errorf("unexpected tasks: %v", tasks)
+	}
+	if len(s.listTasks) == 0 {
+		t.Fatal("ListTasks was not called")
+	}
+	for _, body := range s.listTasks {
+		if _, ok := body["startedBy"]; ok {
+			t.Errorf("startedBy must not be sent with other filters: %v", body)
+		}
+		if body["family"] != "web" || body["launchType"] != "FARGATE" {
+			t.Errorf("unexpected request: %v", body)
+		}
+	}
+}
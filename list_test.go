@@ -0,0 +1,201 @@
+package ecsta
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTaskWatcher(t *testing.T) {
+	task := func(id, status string) types.Task {
+		return types.Task{
+			TaskArn:    aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster/" + id),
+			LastStatus: aws.String(status),
+		}
+	}
+	ids := func(tasks []types.Task) []string {
+		var ss []string
+		for _, t := range tasks {
+			ss = append(ss, arnToName(*t.TaskArn)+":"+aws.ToString(t.LastStatus))
+		}
+		return ss
+	}
+	now := time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC)
+	w := newTaskWatcher()
+
+	changed, transitions := w.update([]types.Task{task("a", "RUNNING"), task("b", "PROVISIONING")}, now)
+	if diff := cmp.Diff([]string{"a:RUNNING", "b:PROVISIONING"}, ids(changed)); diff != "" {
+		t.Errorf("unexpected changed tasks: %s", diff)
+	}
+	if len(transitions) != 0 {
+		t.Errorf("unexpected transitions at first: %v", transitions)
+	}
+
+	changed, transitions = w.update([]types.Task{task("a", "RUNNING"), task("b", "RUNNING"), task("c", "PROVISIONING")}, now)
+	if diff := cmp.Diff([]string{"b:RUNNING", "c:PROVISIONING"}, ids(changed)); diff != "" {
+		t.Errorf("unexpected changed tasks: %s", diff)
+	}
+	expected := []taskTransition{
+		{at: now, id: "b", from: "PROVISIONING", to: "RUNNING"},
+		{at: now, id: "c", from: "", to: "PROVISIONING"},
+	}
+	if diff := cmp.Diff(expected, transitions, cmp.AllowUnexported(taskTransition{})); diff != "" {
+		t.Errorf("unexpected transitions: %s", diff)
+	}
+	if s := transitions[0].String(); !strings.HasSuffix(s, "b PROVISIONING → \x1b[32mRUNNING\x1b[0m") {
+		t.Errorf("unexpected transition string: %q", s)
+	}
+	if s := transitions[1].String(); !strings.HasSuffix(s, "c (new) → \x1b[33mPROVISIONING\x1b[0m") {
+		t.Errorf("unexpected transition string: %q", s)
+	}
+
+	changed, transitions = w.update([]types.Task{task("a", "RUNNING"), task("b", "RUNNING"), task("c", "PROVISIONING")}, now)
+	if len(changed) != 0 || len(transitions) != 0 {
+		t.Errorf("unexpected changes: %v %v", changed, transitions)
+	}
+
+	// a and c are no longer listed (e.g. stopped with --status running)
+	changed, transitions = w.update([]types.Task{task("b", "RUNNING")}, now)
+	if len(changed) != 0 {
+		t.Errorf("unexpected changed tasks: %v", changed)
+	}
+	expected = []taskTransition{
+		{at: now, id: "a", from: "RUNNING", to: taskGone},
+		{at: now, id: "c", from: "PROVISIONING", to: taskGone},
+	}
+	if diff := cmp.Diff(expected, transitions, cmp.AllowUnexported(taskTransition{})); diff != "" {
+		t.Errorf("unexpected transitions: %s", diff)
+	}
+	if s := transitions[0].String(); !strings.HasSuffix(s, "a RUNNING → \x1b[31m(gone)\x1b[0m") {
+		t.Errorf("unexpected transition string: %q", s)
+	}
+
+	// gone tasks are forgotten, and reported as new when listed again
+	changed, transitions = w.update([]types.Task{task("a", "STOPPED"), task("b", "RUNNING")}, now)
+	if diff := cmp.Diff([]string{"a:STOPPED"}, ids(changed)); diff != "" {
+		t.Errorf("unexpected changed tasks: %s", diff)
+	}
+	expected = []taskTransition{{at: now, id: "a", from: "", to: "STOPPED"}}
+	if diff := cmp.Diff(expected, transitions, cmp.AllowUnexported(taskTransition{})); diff != "" {
+		t.Errorf("unexpected transitions: %s", diff)
+	}
+}
+
+func TestFilterTasksByAge(t *testing.T) {
+	now := time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC)
+	task := func(id string, age time.Duration) types.Task {
+		return types.Task{
+			TaskArn:   aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster/" + id),
+			CreatedAt: aws.Time(now.Add(-age)),
+		}
+	}
+	tasks := []types.Task{task("a", time.Minute), task("b", time.Hour), task("c", 24*time.Hour), {TaskArn: aws.String("task/cluster/d")}}
+	ids := func(tasks []types.Task) []string {
+		var ss []string
+		for _, t := range tasks {
+			ss = append(ss, arnToName(*t.TaskArn))
+		}
+		return ss
+	}
+	cases := []struct {
+		olderThan, newerThan time.Duration
+		expected             []string
+	}{
+		{0, 0, []string{"a", "b", "c", "d"}},
+		{30 * time.Minute, 0, []string{"b", "c"}},
+		{0, 2 * time.Hour, []string{"a", "b"}},
+		{30 * time.Minute, 2 * time.Hour, []string{"b"}},
+	}
+	for _, c := range cases {
+		got := ids(filterTasksByAge(tasks, c.olderThan, c.newerThan, now))
+		if diff := cmp.Diff(c.expected, got); diff != "" {
+			t.Errorf("older than %s, newer than %s: %s", c.olderThan, c.newerThan, diff)
+		}
+	}
+}
+
+func TestSortTasks(t *testing.T) {
+	base := time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC)
+	task := func(id, status, td string, min int) types.Task {
+		return types.Task{
+			TaskArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster/" + id),
+			LastStatus:        aws.String(status),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/" + td),
+			CreatedAt:         aws.Time(base.Add(time.Duration(min) * time.Minute)),
+		}
+	}
+	newTasks := func() []types.Task {
+		return []types.Task{
+			task("a", "STOPPED", "app:10", 3),
+			task("b", "RUNNING", "app:9", 2),
+			task("c", "PENDING", "batch:1", 4),
+			task("d", "RUNNING", "app:10", 1),
+		}
+	}
+	ids := func(tasks []types.Task) string {
+		var ss []string
+		for _, t := range tasks {
+			ss = append(ss, arnToName(*t.TaskArn))
+		}
+		return strings.Join(ss, ",")
+	}
+	cases := map[string]string{
+		"none":           "a,b,c,d",
+		"createdAt":      "d,b,a,c",
+		"status":         "c,d,b,a",
+		"taskDefinition": "b,d,a,c",
+	}
+	for by, expected := range cases {
+		tasks := newTasks()
+		sortTasks(tasks, by)
+		if got := ids(tasks); got != expected {
+			t.Errorf("sort by %s: expected %s, got %s", by, expected, got)
+		}
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	now := flextime.Now()
+	task := func(group, td, status string, lt types.LaunchType) types.Task {
+		return types.Task{
+			TaskArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster/" + group + td + status),
+			Group:             aws.String(group),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/" + td),
+			LastStatus:        aws.String(status),
+			LaunchType:        lt,
+		}
+	}
+	var tasks []types.Task
+	for range 8 {
+		tasks = append(tasks, task("service:api", "api:42", "RUNNING", types.LaunchTypeFargate))
+	}
+	tasks = append(tasks,
+		task("service:api", "api:41", "RUNNING", types.LaunchTypeFargate),
+		task("service:api", "api:41", "RUNNING", types.LaunchTypeEc2),
+		task("service:api", "api:42", "PROVISIONING", types.LaunchTypeFargate),
+		task("service:api", "api:40", "STOPPED", types.LaunchTypeFargate),
+		task("service:api", "api:40", "STOPPED", types.LaunchTypeFargate),
+		task("service:api", "api:39", "STOPPED", types.LaunchTypeFargate),
+		task("family:batch", "batch:9", "STOPPING", types.LaunchTypeFargate),
+	)
+	// stopped 10 minutes, 50 minutes and 2 hours ago
+	for i, age := range []time.Duration{10 * time.Minute, 50 * time.Minute, 2 * time.Hour} {
+		tasks[11+i].StoppedAt = aws.Time(now.Add(-age))
+	}
+	app := &Ecsta{Config: &Config{Output: "tsv"}}
+	buf := &strings.Builder{}
+	if err := app.printSummary(buf, &taskList{tasks: tasks}, &ListOption{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Group\tRunning\tPending\tStopping\tStoppedLastHour\tTaskDefinitions\tLaunchTypes\n" +
+		"family:batch\t0\t0\t1\t0\tbatch:9 (1)\tFARGATE (1)\n" +
+		"service:api\t10\t1\t0\t2\tapi:42 (9), api:41 (2)\tEC2 (1), FARGATE (10)\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected summary: %s", diff)
+	}
+}
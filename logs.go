@@ -1,13 +1,20 @@
 package ecsta
 
 import (
+	"bytes"
+	"compress/gzip"
+	"container/heap"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,40 +23,91 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/itchyny/gojq"
+	"github.com/samber/lo"
 	"github.com/tkuchiki/parsetime"
 )
 
 type LogsOption struct {
 	ID        string        `help:"task ID"`
 	StartTime string        `help:"a start time of logs" short:"s"`
+	EndTime   string        `help:"an end time of logs. defaults to start-time + duration"`
+	Since     time.Duration `help:"show logs since the duration ago (e.g. 2h)"`
 	Duration  time.Duration `help:"log timestamps duration" short:"d" default:"1m"`
+	Tail      int           `help:"show the last N log events of each container. the start time is not bounded unless --start-time or --since is specified"`
 	Follow    bool          `help:"follow logs" short:"f"`
 	Container string        `help:"container name"`
 	Family    *string       `help:"task definition family name"`
 	Service   *string       `help:"ECS service name. When combined with --family, tasks of other services sharing the family are excluded."`
 	JSON      bool          `help:"output as JSON lines" short:"j"`
+	AllTasks  bool          `help:"show logs of all tasks of the service or family, including recently stopped tasks"`
+
+	FilterPattern string `help:"CloudWatch Logs filter pattern to filter log events on the server side"`
+	Grep          string `help:"show only log messages that match the regular expression"`
+	GrepV         string `name:"grep-v" help:"hide log messages that match the regular expression"`
+	ParseJSON     bool   `help:"parse log messages as JSON. parsed messages are nested as objects in JSON output"`
+	Query         string `help:"a jq query to format log messages parsed as JSON. implies --parse-json"`
+
+	MergeWindow time.Duration `help:"buffer log events in the window to output them in timestamp order across streams. 0 outputs them as soon as they arrive" default:"2s"`
+	LiveTail    bool          `help:"follow logs by CloudWatch Logs Live Tail instead of polling. falls back to polling when Live Tail is not available"`
+	Pretty      string        `help:"human-friendly colored output (auto, always, never). auto enables it when stdout is a terminal" enum:"auto,always,never" default:"auto"`
+	Timestamps  string        `help:"timestamp format of the pretty output (local, relative)" enum:"local,relative" default:"local"`
+	OutDir      string        `help:"write logs to files per container (and per task with --all-tasks) in the directory instead of stdout"`
+	Gzip        bool          `help:"compress log files by gzip. effective with --out-dir"`
 }
 
 func (opt *LogsOption) ResolveTimestamps() (time.Time, time.Time, error) {
+	if opt.StartTime != "" && opt.Since != 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("start-time and since cannot be specified at the same time")
+	}
+	if opt.EndTime != "" && opt.Follow {
+		return time.Time{}, time.Time{}, fmt.Errorf("end-time and follow cannot be specified at the same time")
+	}
+	if opt.Tail < 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("tail must be a positive number")
+	}
+	p, err := parsetime.NewParseTime()
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to create parsetime: %w", err)
+	}
 	var startTime, endTime time.Time
-	if opt.StartTime != "" {
-		p, err := parsetime.NewParseTime()
+	if opt.EndTime != "" {
+		t, err := p.Parse(opt.EndTime)
 		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("failed to create parsetime: %w", err)
+			return time.Time{}, time.Time{}, fmt.Errorf("failed to parse end time: %w", err)
 		}
+		endTime = t
+	}
+	now := flextime.Now()
+	switch {
+	case opt.StartTime != "":
 		t, err := p.Parse(opt.StartTime)
 		if err != nil {
 			return time.Time{}, time.Time{}, fmt.Errorf("failed to parse start time: %w", err)
 		}
 		startTime = t
-		endTime = t.Add(opt.Duration)
-	} else {
-		now := flextime.Now()
+		if endTime.IsZero() {
+			endTime = t.Add(opt.Duration)
+		}
+	case opt.Since != 0:
+		startTime = now.Add(-opt.Since)
+		if endTime.IsZero() {
+			endTime = now
+		}
+	case !endTime.IsZero():
+		startTime = endTime.Add(-opt.Duration)
+	default:
 		startTime = now.Add(-opt.Duration)
 		endTime = now
 	}
+	if endTime.Before(startTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end time %s is before start time %s", endTime, startTime)
+	}
+	if opt.Tail > 0 && opt.StartTime == "" && opt.Since == 0 {
+		// --tail shows the last N events regardless of --duration
+		startTime = time.Time{}
+	}
 	if opt.Follow {
 		endTime = time.Time{}
 	}
@@ -58,8 +116,12 @@ func (opt *LogsOption) ResolveTimestamps() (time.Time, time.Time, error) {
 
 type logRecord struct {
 	Time      string `json:"time"`
+	Task      string `json:"task,omitempty"`
 	Container string `json:"container"`
 	Msg       string `json:"msg"`
+
+	ts     time.Time
+	parsed any // the message parsed as JSON
 }
 
 type logEncoder interface {
@@ -71,7 +133,11 @@ type logTextEncoder struct {
 }
 
 func (e *logTextEncoder) Encode(v *logRecord) error {
-	_, err := fmt.Fprintln(e.w, strings.Join([]string{v.Time, v.Container, v.Msg}, "\t"))
+	cols := []string{v.Time, v.Container, v.Msg}
+	if v.Task != "" {
+		cols = []string{v.Time, v.Task, v.Container, v.Msg}
+	}
+	_, err := fmt.Fprintln(e.w, strings.Join(cols, "\t"))
 	return err
 }
 
@@ -80,6 +146,13 @@ type logJSONEncoder struct {
 }
 
 func (e *logJSONEncoder) Encode(v *logRecord) error {
+	if v.parsed != nil {
+		// nest the parsed message instead of the string
+		return e.enc.Encode(&struct {
+			*logRecord
+			Msg any `json:"msg"`
+		}{v, v.parsed})
+	}
 	return e.enc.Encode(v)
 }
 
@@ -90,77 +163,569 @@ func newLogEncoder(w io.Writer, jsonFormat bool) logEncoder {
 	return &logTextEncoder{w: w}
 }
 
+// logFileEncoder writes log records to files per container, or per task and container.
+type logFileEncoder struct {
+	dir        string
+	jsonFormat bool
+	gzip       bool
+	perTask    bool
+	files      map[string]*logFile
+	paths      []string // in the order of creation
+}
+
+type logFile struct {
+	f     *os.File
+	gz    *gzip.Writer
+	enc   logEncoder
+	lines *lineCounter
+}
+
+// lineCounter counts lines written to the writer.
+type lineCounter struct {
+	w     io.Writer
+	lines int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.lines += bytes.Count(p[:n], []byte{'\n'})
+	return n, err
+}
+
+// logFileSummary is the number of lines written to a log file.
+type logFileSummary struct {
+	Path  string
+	Lines int
+}
+
+func newLogFileEncoder(dir string, jsonFormat, gzip, perTask bool) *logFileEncoder {
+	return &logFileEncoder{
+		dir:        dir,
+		jsonFormat: jsonFormat,
+		gzip:       gzip,
+		perTask:    perTask,
+		files:      map[string]*logFile{},
+	}
+}
+
+// path returns the file path for the log record. files are named by the container (and task).
+func (e *logFileEncoder) path(v *logRecord) string {
+	name := v.Container + ".log"
+	if e.gzip {
+		name += ".gz"
+	}
+	if e.perTask && v.Task != "" {
+		return filepath.Join(e.dir, v.Task, name)
+	}
+	return filepath.Join(e.dir, name)
+}
+
+func (e *logFileEncoder) Encode(v *logRecord) error {
+	path := e.path(v)
+	lf, ok := e.files[path]
+	if !ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		// append to existing files not to lose logs saved before. a gzip file with multiple members is valid
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		slog.Info("writing logs", "path", path)
+		lf = &logFile{f: f}
+		var w io.Writer = f
+		if e.gzip {
+			lf.gz = gzip.NewWriter(f)
+			w = lf.gz
+		}
+		lf.lines = &lineCounter{w: w}
+		lf.enc = newLogEncoder(lf.lines, e.jsonFormat)
+		e.files[path] = lf
+		e.paths = append(e.paths, path)
+	}
+	return lf.enc.Encode(v)
+}
+
+// Close closes all files and returns the summary of them.
+func (e *logFileEncoder) Close() ([]logFileSummary, error) {
+	var errs []error
+	summary := make([]logFileSummary, 0, len(e.paths))
+	for _, path := range e.paths {
+		lf := e.files[path]
+		if lf.gz != nil {
+			if err := lf.gz.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close gzip writer of %s: %w", path, err))
+			}
+		}
+		if err := lf.f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", path, err))
+		}
+		summary = append(summary, logFileSummary{Path: path, Lines: lf.lines.lines})
+	}
+	e.files = map[string]*logFile{}
+	e.paths = nil
+	return summary, errors.Join(errs...)
+}
+
+// logPrettyColors are ANSI colors for containers. red is reserved for errors.
+var logPrettyColors = []string{
+	"36", // cyan
+	"32", // green
+	"35", // magenta
+	"34", // blue
+	"33", // yellow
+	"96", // bright cyan
+	"92", // bright green
+	"95", // bright magenta
+	"94", // bright blue
+	"93", // bright yellow
+}
+
+var logLevelRegexp = regexp.MustCompile(`\b(?:ERROR|FATAL|PANIC|CRITICAL|WARN|WARNING)\b|(?i:level"?\s*[:=]\s*"?(?:error|fatal|panic|critical|warn|warning)\b)`)
+
+// logPrettyEncoder prints log records for humans.
+// Each container has a stable color and levels like ERROR or WARN are highlighted.
+type logPrettyEncoder struct {
+	w        io.Writer
+	relative bool
+	width    int
+}
+
+func newLogPrettyEncoder(w io.Writer, relative bool) *logPrettyEncoder {
+	return &logPrettyEncoder{w: w, relative: relative}
+}
+
+func (e *logPrettyEncoder) Encode(v *logRecord) error {
+	label := v.Container
+	if v.Task != "" {
+		label = shortTaskID(v.Task) + "/" + v.Container
+	}
+	// align messages to the longest label seen so far
+	e.width = max(e.width, len(label))
+	_, err := fmt.Fprintf(e.w, "\x1b[2m%s\x1b[0m \x1b[%sm%-*s\x1b[0m | %s\n",
+		e.timestamp(v.ts), logPrettyColor(label), e.width, label, highlightLogLevel(v.Msg))
+	return err
+}
+
+func (e *logPrettyEncoder) timestamp(ts time.Time) string {
+	if e.relative {
+		d := flextime.Now().Sub(ts).Round(time.Second)
+		return fmt.Sprintf("%9s", d.String()+" ago")
+	}
+	return ts.In(time.Local).Format("2006-01-02 15:04:05.000")
+}
+
+// logPrettyColor returns the color for the label. The same label always has the same color.
+func logPrettyColor(label string) string {
+	h := fnv.New32a()
+	h.Write([]byte(label))
+	return logPrettyColors[h.Sum32()%uint32(len(logPrettyColors))]
+}
+
+func highlightLogLevel(msg string) string {
+	return logLevelRegexp.ReplaceAllStringFunc(msg, func(s string) string {
+		color := "1;31" // bold red
+		if strings.Contains(strings.ToLower(s), "warn") {
+			color = "1;33" // bold yellow
+		}
+		return "\x1b[" + color + "m" + s + "\x1b[0m"
+	})
+}
+
+// shortTaskID returns the first 8 characters of the task ID.
+func shortTaskID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// usePretty reports whether logs are printed by logPrettyEncoder.
+func (opt *LogsOption) usePretty() bool {
+	if opt.JSON || opt.OutDir != "" {
+		return false
+	}
+	switch opt.Pretty {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return isTerminal(os.Stdout)
+	}
+}
+
 func (app *Ecsta) RunLogs(ctx context.Context, opt *LogsOption) error {
 	if app.Config.Output == "json" {
 		opt.JSON = true
 	}
+	if opt.AllTasks {
+		if opt.ID != "" {
+			return fmt.Errorf("all-tasks and id cannot be specified at the same time")
+		}
+		if opt.Service == nil && opt.Family == nil {
+			return fmt.Errorf("all-tasks requires service or family")
+		}
+	}
+	if opt.LiveTail && !opt.Follow {
+		return fmt.Errorf("live-tail requires follow")
+	}
+	if opt.Gzip && opt.OutDir == "" {
+		return fmt.Errorf("gzip requires out-dir")
+	}
+	if opt.Tail > 0 && opt.FilterPattern != "" {
+		return fmt.Errorf("tail and filter-pattern cannot be specified at the same time")
+	}
 	if err := app.SetCluster(ctx); err != nil {
 		return err
 	}
+	startTime, endTime, err := opt.ResolveTimestamps()
+	if err != nil {
+		return err
+	}
+	out := newLogEncoder(os.Stdout, opt.JSON)
+	if opt.usePretty() {
+		out = newLogPrettyEncoder(os.Stdout, opt.Timestamps == "relative")
+	}
+	if opt.OutDir != "" {
+		fenc := newLogFileEncoder(opt.OutDir, opt.JSON, opt.Gzip, opt.AllTasks)
+		// closed after the merger is closed
+		defer app.closeLogFiles(fenc)
+		out = fenc
+	}
+	enc, err := newLogJSONParseEncoder(out, opt.ParseJSON, opt.Query)
+	if err != nil {
+		return err
+	}
+	enc, err = newLogGrepEncoder(enc, opt.Grep, opt.GrepV)
+	if err != nil {
+		return err
+	}
+	merger := newLogMerger(enc, opt.MergeWindow)
+	defer merger.Close()
+	if opt.AllTasks {
+		if err := app.runLogsAllTasks(ctx, opt, merger, startTime, endTime); err != nil {
+			return err
+		}
+		return merger.Close()
+	}
 	task, err := app.findTask(ctx, &optionFindTask{id: opt.ID, family: opt.Family, service: opt.Service})
 	if err != nil {
 		return fmt.Errorf("failed to select tasks: %w", err)
 	}
-	res, err := app.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
-		TaskDefinition: task.TaskDefinitionArn,
-	})
+	td, err := app.describeTaskDefinition(ctx, task)
 	if err != nil {
-		return fmt.Errorf("failed to describe task definition: %w", err)
+		return err
+	}
+	streams, containerNames, notes := taskLogStreams(task, td, opt.Container)
+	if opt.Container != "" && !lo.Contains(containerNames, opt.Container) {
+		return fmt.Errorf("container %s not found. available containers: %s", opt.Container, strings.Join(containerNames, ", "))
+	}
+	if len(streams) == 0 {
+		return fmt.Errorf("no logs found in CloudWatch Logs. %s", strings.Join(notes, "; "))
+	}
+	for _, note := range notes {
+		slog.Info("logs are not shown", "container", note)
 	}
 	var wg sync.WaitGroup
-	startTime, endTime, err := opt.ResolveTimestamps()
+	app.startLogFollowers(ctx, &wg, streams, opt.FilterPattern, followOption{
+		startTime: startTime,
+		endTime:   endTime,
+		follow:    opt.Follow,
+		liveTail:  opt.LiveTail,
+		tail:      opt.Tail,
+		out:       merger.In(),
+	})
+	wg.Wait()
+	return merger.Close()
+}
+
+// closeLogFiles closes the log files and shows the summary of them.
+func (app *Ecsta) closeLogFiles(enc *logFileEncoder) {
+	summary, err := enc.Close()
 	if err != nil {
-		return err
+		slog.Error("failed to close log files", "error", err)
+	}
+	if len(summary) == 0 {
+		slog.Info("no logs are written")
+		return
+	}
+	f, err := newRowFormatter(app.w, app.Config.Output, []string{"Path", "Lines"})
+	if err != nil {
+		slog.Error("failed to show the summary", "error", err)
+		return
+	}
+	for _, s := range summary {
+		f.AddRow([]string{s.Path, strconv.Itoa(s.Lines)})
+	}
+	f.Close()
+}
+
+// logsTaskDiscoveryInterval is the interval to discover new tasks in --all-tasks --follow mode.
+var logsTaskDiscoveryInterval = 10 * time.Second
+
+// stoppedTaskLogsMargin is the margin after a task stopped to read its logs that may be delivered late.
+const stoppedTaskLogsMargin = time.Minute
+
+// runLogsAllTasks shows logs of all tasks of the service or family.
+// In follow mode, tasks that appear later are picked up periodically.
+func (app *Ecsta) runLogsAllTasks(ctx context.Context, opt *LogsOption, merger *logMerger, startTime, endTime time.Time) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	known := map[string]bool{}
+	taskDefs := map[string]*types.TaskDefinition{}
+	for {
+		tasks, err := app.listTasks(ctx, app.cluster, &optionListTasks{
+			family:  opt.Family,
+			service: opt.Service,
+		})
+		if err != nil {
+			if len(known) == 0 {
+				return fmt.Errorf("failed to list tasks: %w", err)
+			}
+			slog.Warn("failed to list tasks", "error", err)
+		}
+		for _, task := range tasks {
+			taskID := arnToName(*task.TaskArn)
+			if known[taskID] || !taskInLogsRange(task, startTime, endTime) {
+				continue
+			}
+			tdArn := aws.ToString(task.TaskDefinitionArn)
+			td, ok := taskDefs[tdArn]
+			if !ok {
+				td, err = app.describeTaskDefinition(ctx, task)
+				if err != nil {
+					slog.Warn("failed to describe task definition", "task", taskID, "error", err)
+					continue
+				}
+				taskDefs[tdArn] = td
+			}
+			known[taskID] = true
+			// logs of stopped tasks are not followed
+			follow, taskEndTime := opt.Follow, endTime
+			if task.StoppedAt != nil {
+				follow = false
+				if taskEndTime.IsZero() {
+					taskEndTime = task.StoppedAt.Add(stoppedTaskLogsMargin)
+				}
+			}
+			streams, _, notes := taskLogStreams(task, td, opt.Container)
+			for _, note := range notes {
+				slog.Debug("logs are not shown", "task", taskID, "container", note)
+			}
+			slog.Info("following logs of task", "task", taskID, "status", aws.ToString(task.LastStatus), "streams", len(streams))
+			app.startLogFollowers(ctx, &wg, streams, opt.FilterPattern, followOption{
+				startTime: startTime,
+				endTime:   taskEndTime,
+				follow:    follow,
+				liveTail:  opt.LiveTail,
+				tail:      opt.Tail,
+				taskID:    taskID,
+				out:       merger.In(),
+			})
+		}
+		if len(known) == 0 {
+			return fmt.Errorf("no tasks found")
+		}
+		if !opt.Follow {
+			return nil
+		}
+		if err := sleepWithContext(ctx, logsTaskDiscoveryInterval); err != nil {
+			return nil
+		}
+	}
+}
+
+// taskInLogsRange reports whether the task may have logs between startTime and endTime.
+// Tasks stopped before startTime or created after endTime are out of range.
+func taskInLogsRange(task types.Task, startTime, endTime time.Time) bool {
+	if task.StoppedAt != nil && task.StoppedAt.Before(startTime) {
+		return false
 	}
-	follows := 0
-	containerNames := make([]string, 0, len(res.TaskDefinition.ContainerDefinitions))
-	for _, c := range res.TaskDefinition.ContainerDefinitions {
+	if !endTime.IsZero() && task.CreatedAt != nil && task.CreatedAt.After(endTime) {
+		return false
+	}
+	return true
+}
+
+// startLogFollowers starts goroutines to read log events of the streams of a task.
+// When filterPattern is specified, log events are filtered on the server side by FilterLogEvents API for each log group.
+func (app *Ecsta) startLogFollowers(ctx context.Context, wg *sync.WaitGroup, streams []logStream, filterPattern string, base followOption) {
+	if base.liveTail && base.Follow() {
+		groups := lo.GroupBy(streams, func(s logStream) string { return s.group })
+		for group, streams := range groups {
+			// a Live Tail session accepts up to 100 log stream names of a log group
+			for _, chunk := range lo.Chunk(streams, liveTailMaxLogStreams) {
+				opt := base
+				opt.logGroup = group
+				opt.filterPattern = filterPattern
+				wg.Go(func() {
+					if err := app.liveTailLogs(ctx, &opt, chunk); err != nil {
+						slog.Error("failed to live tail logs", "log_group", group, "error", err)
+					}
+				})
+			}
+		}
+		return
+	}
+	if filterPattern != "" {
+		groups := lo.GroupBy(streams, func(s logStream) string { return s.group })
+		for group, streams := range groups {
+			opt := base
+			opt.logGroup = group
+			opt.filterPattern = filterPattern
+			wg.Go(func() {
+				if err := app.filterLogs(ctx, &opt, streams); err != nil {
+					slog.Error("failed to filter logs", "log_group", group, "error", err)
+				}
+			})
+		}
+		return
+	}
+	for _, stream := range streams {
+		opt := base
+		opt.logGroup = stream.group
+		opt.logStream = stream.stream
+		opt.containerName = stream.container
+		wg.Go(func() {
+			if err := app.followLogs(ctx, &opt); err != nil {
+				slog.Error("failed to follow logs", "error", err)
+			}
+		})
+	}
+}
+
+type logStream struct {
+	group     string
+	stream    string
+	container string
+}
+
+// taskLogStreams returns the CloudWatch Logs streams of the containers in the task and all container names.
+// When container is not empty, only the log stream of the container is returned.
+// For containers whose logs are not resolved to CloudWatch Logs streams, notes describe where their logs go.
+func taskLogStreams(task types.Task, td *types.TaskDefinition, container string) ([]logStream, []string, []string) {
+	var streams []logStream
+	var notes []string
+	containerNames := make([]string, 0, len(td.ContainerDefinitions))
+	for _, c := range td.ContainerDefinitions {
 		name := aws.ToString(c.Name)
 		containerNames = append(containerNames, name)
-		if opt.Container != "" && opt.Container != name {
+		if container != "" && container != name {
 			continue
 		}
-		if c.LogConfiguration == nil {
+		stream, err := resolveLogStream(task, c)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("%s: %s", name, err))
 			continue
 		}
-		if c.LogConfiguration.LogDriver != types.LogDriverAwslogs {
-			continue
+		streams = append(streams, stream)
+	}
+	return streams, containerNames, notes
+}
+
+// firelensCloudWatchPlugins are the names of FireLens output plugins that send logs to CloudWatch Logs.
+var firelensCloudWatchPlugins = []string{"cloudwatch_logs", "cloudwatch"}
+
+// resolveLogStream resolves the CloudWatch Logs stream of the container.
+// The error describes where the logs go when they are not resolved.
+func resolveLogStream(task types.Task, c types.ContainerDefinition) (logStream, error) {
+	name := aws.ToString(c.Name)
+	taskID := arnToName(*task.TaskArn)
+	if c.LogConfiguration == nil {
+		return logStream{}, fmt.Errorf("no log configuration")
+	}
+	logOpts := c.LogConfiguration.Options
+	switch driver := c.LogConfiguration.LogDriver; driver {
+	case types.LogDriverAwslogs:
+		prefix := logOpts["awslogs-stream-prefix"]
+		if prefix == "" {
+			return logStream{}, fmt.Errorf("awslogs to log group %s without awslogs-stream-prefix", logOpts["awslogs-group"])
 		}
-		logOpts := c.LogConfiguration.Options
-		logGroup := logOpts["awslogs-group"]
-		logStream := fmt.Sprintf("%s/%s/%s", logOpts["awslogs-stream-prefix"], *c.Name, arnToName(*task.TaskArn))
-		wg.Add(1)
-		follows++
-		go func() {
-			defer wg.Done()
-			if err := app.followLogs(ctx, &followOption{
-				logGroup:      logGroup,
-				logStream:     logStream,
-				startTime:     startTime,
-				endTime:       endTime,
-				follow:        opt.Follow,
-				containerName: name,
-				json:          opt.JSON,
-			}); err != nil {
-				slog.Error("failed to follow logs", "error", err)
+		return logStream{
+			group:     logOpts["awslogs-group"],
+			stream:    fmt.Sprintf("%s/%s/%s", prefix, name, taskID),
+			container: name,
+		}, nil
+	case types.LogDriverAwsfirelens:
+		plugin := logOpts["Name"]
+		if !lo.Contains(firelensCloudWatchPlugins, plugin) {
+			if plugin == "" {
+				return logStream{}, fmt.Errorf("awsfirelens with the output defined in the log router configuration file")
+			}
+			return logStream{}, fmt.Errorf("awsfirelens with output plugin %s", plugin)
+		}
+		vars := firelensTemplateVars(task, name)
+		group, err := expandFirelensTemplate(logOpts["log_group_name"], vars)
+		if err != nil || group == "" {
+			return logStream{}, fmt.Errorf("awsfirelens %s to log group %q which is not resolved", plugin, logOpts["log_group_name"])
+		}
+		var stream string
+		switch {
+		case logOpts["log_stream_name"] != "":
+			stream, err = expandFirelensTemplate(logOpts["log_stream_name"], vars)
+			if err != nil {
+				return logStream{}, fmt.Errorf("awsfirelens %s to log group %s, log stream %q which is not resolved", plugin, group, logOpts["log_stream_name"])
 			}
-		}()
+		case logOpts["log_stream_prefix"] != "":
+			stream = logOpts["log_stream_prefix"] + vars["tag"]
+		default:
+			return logStream{}, fmt.Errorf("awsfirelens %s to log group %s with a log stream template which is not supported", plugin, group)
+		}
+		return logStream{group: group, stream: stream, container: name}, nil
+	default:
+		return logStream{}, fmt.Errorf("log driver %s", driver)
 	}
-	wg.Wait()
-	if follows == 0 {
-		return fmt.Errorf("no logs found. available containers: %s", strings.Join(containerNames, ", "))
+}
+
+// firelensTemplateVars returns variables of FireLens templates like $(ecs_task_id).
+func firelensTemplateVars(task types.Task, container string) map[string]string {
+	taskID := arnToName(*task.TaskArn)
+	return map[string]string{
+		"ecs_task_id":         taskID,
+		"ecs_task_arn":        aws.ToString(task.TaskArn),
+		"ecs_cluster":         arnToName(aws.ToString(task.ClusterArn)),
+		"ecs_task_definition": arnToName(aws.ToString(task.TaskDefinitionArn)),
+		"container_name":      container,
+		// FireLens tags logs of the container as "<container name>-firelens-<task ID>"
+		"tag": fmt.Sprintf("%s-firelens-%s", container, taskID),
 	}
-	return nil
+}
+
+var firelensTemplateRegexp = regexp.MustCompile(`\$\(([^)]+)\)`)
+
+// expandFirelensTemplate expands variables like $(ecs_task_id) in s.
+// It returns an error when s contains unknown variables.
+func expandFirelensTemplate(s string, vars map[string]string) (string, error) {
+	var unknown []string
+	expanded := firelensTemplateRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		key := firelensTemplateRegexp.FindStringSubmatch(m)[1]
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		unknown = append(unknown, m)
+		return m
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown variables: %s", strings.Join(unknown, ", "))
+	}
+	return expanded, nil
 }
 
 type followOption struct {
 	logGroup      string
 	logStream     string
 	containerName string
+	taskID        string
 	startTime     time.Time
 	endTime       time.Time
 	follow        bool
-	json          bool
+	liveTail      bool
+	tail          int
+	filterPattern string
+	out           chan<- *logRecord
 }
 
 func (o followOption) Follow() bool {
@@ -168,18 +733,33 @@ func (o followOption) Follow() bool {
 }
 
 func (app *Ecsta) followLogs(ctx context.Context, opt *followOption) error {
+	startTime := opt.startTime
+	if opt.tail > 0 {
+		tailEnd, err := app.tailLogs(ctx, opt)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !opt.Follow() {
+			return nil
+		}
+		// follow log events after the tail
+		startTime = tailEnd.Add(time.Millisecond)
+	}
 	var nextToken *string
 	in := &cloudwatchlogs.GetLogEventsInput{
 		LogGroupName:  &opt.logGroup,
 		LogStreamName: &opt.logStream,
-		StartTime:     aws.Int64(timeToInt64msec(opt.startTime)),
 		Limit:         aws.Int32(1000),
 	}
+	if !startTime.IsZero() {
+		in.StartTime = aws.Int64(timeToInt64msec(startTime))
+	}
 	if !opt.Follow() {
 		in.EndTime = aws.Int64(timeToInt64msec(opt.endTime))
 	}
-	enc := newLogEncoder(os.Stdout, opt.json)
-
 FOLLOW:
 	for {
 		if err := sleepWithContext(ctx, time.Second); err != nil {
@@ -212,12 +792,16 @@ FOLLOW:
 			if !opt.Follow() && ts.After(opt.endTime) {
 				break FOLLOW
 			}
-			if err := enc.Encode(&logRecord{
+			select {
+			case opt.out <- &logRecord{
 				Time:      ts.Format(time.RFC3339Nano),
 				Msg:       aws.ToString(e.Message),
+				Task:      opt.taskID,
 				Container: opt.containerName,
-			}); err != nil {
-				return fmt.Errorf("failed to encode log record: %w", err)
+				ts:        ts,
+			}:
+			case <-ctx.Done():
+				return nil
 			}
 		}
 		if aws.ToString(nextToken) == aws.ToString(res.NextForwardToken) {
@@ -231,6 +815,510 @@ FOLLOW:
 	return nil
 }
 
+// tailLogs sends the last opt.tail log events of the stream to opt.out.
+// It reads log events backward from the end time (now in follow mode) and returns the end time.
+func (app *Ecsta) tailLogs(ctx context.Context, opt *followOption) (time.Time, error) {
+	endTime := opt.endTime
+	if opt.Follow() {
+		endTime = flextime.Now()
+	}
+	in := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  &opt.logGroup,
+		LogStreamName: &opt.logStream,
+		EndTime:       aws.Int64(timeToInt64msec(endTime)),
+		Limit:         aws.Int32(int32(min(opt.tail, 10000))),
+		StartFromHead: aws.Bool(false),
+	}
+	if !opt.startTime.IsZero() {
+		in.StartTime = aws.Int64(timeToInt64msec(opt.startTime))
+	}
+	var events []logsTypes.OutputLogEvent
+	for len(events) < opt.tail {
+		res, err := app.logs.GetLogEvents(ctx, in)
+		if err != nil {
+			var ne *logsTypes.ResourceNotFoundException
+			if errors.As(err, &ne) {
+				// log group or log stream not found yet
+				return endTime, nil
+			}
+			return endTime, fmt.Errorf("failed to get log events: %w", err)
+		}
+		// events in a page are in chronological order, and pages go backward
+		events = append(res.Events, events...)
+		if len(res.Events) == 0 || aws.ToString(in.NextToken) == aws.ToString(res.NextBackwardToken) {
+			break
+		}
+		in.NextToken = res.NextBackwardToken
+	}
+	if len(events) > opt.tail {
+		events = events[len(events)-opt.tail:]
+	}
+	for _, e := range events {
+		ts := msecToTime(aws.ToInt64(e.Timestamp))
+		select {
+		case opt.out <- &logRecord{
+			Time:      ts.Format(time.RFC3339Nano),
+			Msg:       aws.ToString(e.Message),
+			Task:      opt.taskID,
+			Container: opt.containerName,
+			ts:        ts,
+		}:
+		case <-ctx.Done():
+			return endTime, ctx.Err()
+		}
+	}
+	return endTime, nil
+}
+
+// filterLogsLookback is the period to look back in follow mode of filterLogs
+// for log events that are ingested late.
+const filterLogsLookback = 10 * time.Second
+
+// filterLogsPollInterval is the interval to poll log events in follow mode of filterLogs.
+var filterLogsPollInterval = time.Second
+
+// filterLogs reads log events of the streams in the log group filtered by the filter pattern.
+func (app *Ecsta) filterLogs(ctx context.Context, opt *followOption, streams []logStream) error {
+	containers := make(map[string]string, len(streams))
+	streamNames := make([]string, 0, len(streams))
+	for _, s := range streams {
+		containers[s.stream] = s.container
+		streamNames = append(streamNames, s.stream)
+	}
+	startTime := opt.startTime
+	latest := opt.startTime        // high-water mark of timestamps of events. never moves backward
+	seen := map[string]time.Time{} // event ID -> timestamp
+	for {
+		in := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:   &opt.logGroup,
+			LogStreamNames: streamNames,
+			FilterPattern:  &opt.filterPattern,
+			StartTime:      aws.Int64(timeToInt64msec(startTime)),
+		}
+		if !opt.Follow() {
+			in.EndTime = aws.Int64(timeToInt64msec(opt.endTime))
+		}
+		p := cloudwatchlogs.NewFilterLogEventsPaginator(app.logs, in)
+		for p.HasMorePages() {
+			res, err := p.NextPage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				var ne *logsTypes.ResourceNotFoundException
+				if !errors.As(err, &ne) {
+					slog.Warn("failed to filter log events", "error", err)
+				}
+				break
+			}
+			for _, e := range res.Events {
+				id := aws.ToString(e.EventId)
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				ts := msecToTime(aws.ToInt64(e.Timestamp))
+				seen[id] = ts
+				if ts.After(latest) {
+					latest = ts
+				}
+				select {
+				case opt.out <- &logRecord{
+					Time:      ts.Format(time.RFC3339Nano),
+					Msg:       aws.ToString(e.Message),
+					Task:      opt.taskID,
+					Container: containers[aws.ToString(e.LogStreamName)],
+					ts:        ts,
+				}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+		if !opt.Follow() {
+			return nil
+		}
+		// look back a little from the high-water mark for late events. seen events are skipped
+		if lookback := latest.Add(-filterLogsLookback); lookback.After(startTime) {
+			startTime = lookback
+		}
+		// events before startTime are never queried again
+		for id, ts := range seen {
+			if ts.Before(startTime) {
+				delete(seen, id)
+			}
+		}
+		if err := sleepWithContext(ctx, filterLogsPollInterval); err != nil {
+			return nil
+		}
+	}
+}
+
+// liveTailMaxLogStreams is the maximum number of log stream names in a Live Tail session.
+const liveTailMaxLogStreams = 100
+
+// liveTailReconnectInterval and liveTailMaxReconnectInterval are the initial and maximum delays
+// to reconnect Live Tail sessions closed without delivering log events.
+var (
+	liveTailReconnectInterval    = time.Second
+	liveTailMaxReconnectInterval = time.Minute
+)
+
+// liveTailLogs follows log events of the streams in the log group by CloudWatch Logs Live Tail.
+// Live Tail delivers only log events ingested after the session starts, so log events
+// before that are read by the polling APIs. When the session is closed (e.g. the session
+// reaches the time limit), it reconnects with an increasing delay until a session delivers log events.
+// When Live Tail is not available, it falls back to polling.
+func (app *Ecsta) liveTailLogs(ctx context.Context, opt *followOption, streams []logStream) error {
+	containers := make(map[string]string, len(streams))
+	for _, s := range streams {
+		containers[s.stream] = s.container
+	}
+	poll := *opt
+	poll.liveTail = false
+
+	logGroupARN, err := app.logGroupARN(ctx, opt.logGroup)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		slog.Warn("Live Tail is not available. falling back to polling", "log_group", opt.logGroup, "error", err)
+		app.pollLogs(ctx, streams, poll)
+		return nil
+	}
+	delay := liveTailReconnectInterval
+	for {
+		sessionStart := flextime.Now()
+		out, err := app.logs.StartLiveTail(ctx, &cloudwatchlogs.StartLiveTailInput{
+			LogGroupIdentifiers:   []string{logGroupARN},
+			LogStreamNames:        lo.Keys(containers),
+			LogEventFilterPattern: lo.EmptyableToPtr(opt.filterPattern),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Warn("Live Tail is not available. falling back to polling", "log_group", opt.logGroup, "error", err)
+			app.pollLogs(ctx, streams, poll)
+			return nil
+		}
+		// read log events before the session starts
+		history := poll
+		history.endTime = sessionStart
+		history.follow = false
+		var wg sync.WaitGroup
+		app.startLogFollowers(ctx, &wg, streams, opt.filterPattern, history)
+
+		delivered, err := app.readLiveTail(ctx, out.GetStream(), opt, containers)
+		wg.Wait()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if delivered {
+			delay = liveTailReconnectInterval
+		}
+		slog.Debug("Live Tail session is closed. reconnecting", "log_group", opt.logGroup, "delay", delay, "error", err)
+		// log events while waiting are read by the polling APIs of the next session
+		poll.startTime = flextime.Now()
+		if err := sleepWithContext(ctx, delay); err != nil {
+			return nil
+		}
+		if !delivered {
+			delay = min(delay*2, liveTailMaxReconnectInterval)
+		}
+	}
+}
+
+// pollLogs follows log events of the streams by the polling APIs until ctx is done.
+func (app *Ecsta) pollLogs(ctx context.Context, streams []logStream, opt followOption) {
+	var wg sync.WaitGroup
+	app.startLogFollowers(ctx, &wg, streams, opt.filterPattern, opt)
+	wg.Wait()
+}
+
+// readLiveTail sends log events in the Live Tail session to opt.out until the session is closed.
+// It reports whether the session delivered any log events.
+func (app *Ecsta) readLiveTail(ctx context.Context, stream *cloudwatchlogs.StartLiveTailEventStream, opt *followOption, containers map[string]string) (bool, error) {
+	defer stream.Close()
+	sampled, delivered := false, false
+	for {
+		var ev logsTypes.StartLiveTailResponseStream
+		select {
+		case <-ctx.Done():
+			return delivered, nil
+		case e, ok := <-stream.Events():
+			if !ok {
+				return delivered, stream.Err()
+			}
+			ev = e
+		}
+		switch v := ev.(type) {
+		case *logsTypes.StartLiveTailResponseStreamMemberSessionStart:
+			slog.Debug("Live Tail session started", "log_group", opt.logGroup, "session_id", aws.ToString(v.Value.SessionId))
+		case *logsTypes.StartLiveTailResponseStreamMemberSessionUpdate:
+			if v.Value.SessionMetadata != nil && v.Value.SessionMetadata.Sampled && !sampled {
+				slog.Warn("too many log events. Live Tail shows only sampled log events", "log_group", opt.logGroup)
+				sampled = true
+			}
+			for _, e := range v.Value.SessionResults {
+				delivered = true
+				ts := msecToTime(aws.ToInt64(e.Timestamp))
+				select {
+				case opt.out <- &logRecord{
+					Time:      ts.Format(time.RFC3339Nano),
+					Msg:       aws.ToString(e.Message),
+					Task:      opt.taskID,
+					Container: containers[aws.ToString(e.LogStreamName)],
+					ts:        ts,
+				}:
+				case <-ctx.Done():
+					return delivered, nil
+				}
+			}
+		}
+	}
+}
+
+// logGroupARN returns the ARN of the log group. Live Tail requires log groups specified by ARNs.
+func (app *Ecsta) logGroupARN(ctx context.Context, name string) (string, error) {
+	p := cloudwatchlogs.NewDescribeLogGroupsPaginator(app.logs, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: &name,
+	})
+	for p.HasMorePages() {
+		res, err := p.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to describe log groups: %w", err)
+		}
+		for _, g := range res.LogGroups {
+			if aws.ToString(g.LogGroupName) == name {
+				return aws.ToString(g.LogGroupArn), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("log group %s not found", name)
+}
+
+// logGrepEncoder encodes only log records whose message matches grep and does not match grepV.
+type logGrepEncoder struct {
+	enc   logEncoder
+	grep  *regexp.Regexp
+	grepV *regexp.Regexp
+}
+
+// newLogGrepEncoder wraps enc with regular expression filters. It returns enc as is when no filters are specified.
+func newLogGrepEncoder(enc logEncoder, grep, grepV string) (logEncoder, error) {
+	if grep == "" && grepV == "" {
+		return enc, nil
+	}
+	e := &logGrepEncoder{enc: enc}
+	if grep != "" {
+		re, err := regexp.Compile(grep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern: %w", err)
+		}
+		e.grep = re
+	}
+	if grepV != "" {
+		re, err := regexp.Compile(grepV)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep-v pattern: %w", err)
+		}
+		e.grepV = re
+	}
+	return e, nil
+}
+
+func (e *logGrepEncoder) Encode(v *logRecord) error {
+	if e.grep != nil && !e.grep.MatchString(v.Msg) {
+		return nil
+	}
+	if e.grepV != nil && e.grepV.MatchString(v.Msg) {
+		return nil
+	}
+	return e.enc.Encode(v)
+}
+
+// logJSONParseEncoder parses log messages as JSON and applies the jq query before encoding.
+// Messages that are not JSON objects or arrays are passed through untouched.
+type logJSONParseEncoder struct {
+	enc   logEncoder
+	query *gojq.Query
+}
+
+// newLogJSONParseEncoder wraps enc with the JSON parser. It returns enc as is when parsing is not enabled.
+func newLogJSONParseEncoder(enc logEncoder, parse bool, query string) (logEncoder, error) {
+	if !parse && query == "" {
+		return enc, nil
+	}
+	e := &logJSONParseEncoder{enc: enc}
+	if query != "" {
+		q, err := gojq.Parse(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+		e.query = q
+	}
+	return e, nil
+}
+
+func (e *logJSONParseEncoder) Encode(v *logRecord) error {
+	msg := strings.TrimSpace(v.Msg)
+	if !strings.HasPrefix(msg, "{") && !strings.HasPrefix(msg, "[") {
+		return e.enc.Encode(v)
+	}
+	var parsed any
+	if err := json.Unmarshal([]byte(msg), &parsed); err != nil {
+		return e.enc.Encode(v)
+	}
+	if e.query == nil {
+		rec := *v
+		rec.parsed = parsed
+		return e.enc.Encode(&rec)
+	}
+	// a query may output zero or multiple values. each value is encoded as a record
+	iter := e.query.Run(parsed)
+	for {
+		out, ok := iter.Next()
+		if !ok {
+			return nil
+		}
+		if err, ok := out.(error); ok {
+			slog.Debug("failed to run query", "error", err, "msg", v.Msg)
+			return e.enc.Encode(v)
+		}
+		rec := *v
+		switch val := out.(type) {
+		case string:
+			rec.Msg = val
+		default:
+			b, err := json.Marshal(val)
+			if err != nil {
+				return fmt.Errorf("failed to marshal query result: %w", err)
+			}
+			rec.Msg = string(b)
+			rec.parsed = val
+		}
+		if err := e.enc.Encode(&rec); err != nil {
+			return err
+		}
+	}
+}
+
+// logMerger merges log records from multiple streams and encodes them by a single encoder.
+// Records are buffered in the window after they arrive and are output in timestamp order,
+// so a larger window trades latency for ordering across streams.
+type logMerger struct {
+	enc    logEncoder
+	window time.Duration
+	in     chan *logRecord
+	done   chan struct{}
+	once   sync.Once
+	err    error
+
+	buf logMergeHeap
+	seq uint64
+}
+
+func newLogMerger(enc logEncoder, window time.Duration) *logMerger {
+	m := &logMerger{
+		enc:    enc,
+		window: window,
+		in:     make(chan *logRecord, 1000),
+		done:   make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// In returns the channel to send log records to the merger.
+func (m *logMerger) In() chan<- *logRecord {
+	return m.in
+}
+
+// Close flushes the buffered records and waits for the output to finish.
+// All senders must stop sending before Close is called.
+func (m *logMerger) Close() error {
+	m.once.Do(func() {
+		close(m.in)
+	})
+	<-m.done
+	return m.err
+}
+
+func (m *logMerger) run() {
+	defer close(m.done)
+	var tick <-chan time.Time
+	if m.window > 0 {
+		ticker := time.NewTicker(max(m.window/4, 10*time.Millisecond))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case rec, ok := <-m.in:
+			if !ok {
+				m.flush(time.Time{})
+				return
+			}
+			if m.window <= 0 {
+				m.encode(rec)
+				continue
+			}
+			m.seq++
+			heap.Push(&m.buf, &logMergeItem{rec: rec, arrived: time.Now(), seq: m.seq})
+		case now := <-tick:
+			m.flush(now)
+		}
+	}
+}
+
+// flush outputs the buffered records in timestamp order while the oldest one stays longer than the window.
+// When now is zero, all records are output.
+func (m *logMerger) flush(now time.Time) {
+	for m.buf.Len() > 0 {
+		if !now.IsZero() && m.buf[0].arrived.Add(m.window).After(now) {
+			return
+		}
+		item := heap.Pop(&m.buf).(*logMergeItem)
+		m.encode(item.rec)
+	}
+}
+
+func (m *logMerger) encode(rec *logRecord) {
+	if m.err != nil {
+		return // discard records after an error
+	}
+	if err := m.enc.Encode(rec); err != nil {
+		m.err = fmt.Errorf("failed to encode log record: %w", err)
+	}
+}
+
+type logMergeItem struct {
+	rec     *logRecord
+	arrived time.Time
+	seq     uint64
+}
+
+// logMergeHeap is a min-heap of log records ordered by timestamp, then by arrival.
+type logMergeHeap []*logMergeItem
+
+func (h logMergeHeap) Len() int { return len(h) }
+func (h logMergeHeap) Less(i, j int) bool {
+	if !h[i].rec.ts.Equal(h[j].rec.ts) {
+		return h[i].rec.ts.Before(h[j].rec.ts)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h logMergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *logMergeHeap) Push(x any)   { *h = append(*h, x.(*logMergeItem)) }
+func (h *logMergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
 var epoch = time.Unix(0, 0)
 
 func timeToInt64msec(t time.Time) int64 {
@@ -0,0 +1,368 @@
+package ecsta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// fakeLogsServer is a fake CloudWatch Logs API server supporting the Live Tail event stream.
+type fakeLogsServer struct {
+	liveTail bool
+	closing  bool // Live Tail sessions are closed without log events
+	sessions atomic.Int32
+}
+
+func (s *fakeLogsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	switch r.Header.Get("X-Amz-Target") {
+	case "Logs_20140328.DescribeLogGroups":
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprint(w, `{"logGroups":[{"logGroupName":"/ecs/app","logGroupArn":"arn:aws:logs:us-east-1:123456789012:log-group:/ecs/app"}]}`)
+	case "Logs_20140328.GetLogEvents":
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if strings.Contains(string(body), "nextToken") {
+			fmt.Fprint(w, `{"events":[],"nextForwardToken":"f/1","nextBackwardToken":"b/1"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"events":[{"message":"history","timestamp":%d}],"nextForwardToken":"f/1","nextBackwardToken":"b/1"}`, flextime.Now().Add(-30*time.Second).UnixMilli())
+	case "Logs_20140328.FilterLogEvents":
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprint(w, `{"events":[]}`)
+	case "Logs_20140328.StartLiveTail":
+		if !s.liveTail {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"AccessDeniedException","message":"not authorized"}`)
+			return
+		}
+		if s.closing {
+			s.sessions.Add(1)
+			w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+			w.WriteHeader(http.StatusOK)
+			writeLiveTailEvent(w, "initial-response", `{}`)
+			writeLiveTailEvent(w, "sessionStart", `{"sessionId":"session-1","logGroupIdentifiers":["arn:aws:logs:us-east-1:123456789012:log-group:/ecs/app"]}`)
+			return
+		}
+		if s.sessions.Add(1) > 1 {
+			http.Error(w, "too many sessions", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.WriteHeader(http.StatusOK)
+		writeLiveTailEvent(w, "initial-response", `{}`)
+		writeLiveTailEvent(w, "sessionStart", `{"sessionId":"session-1","logGroupIdentifiers":["arn:aws:logs:us-east-1:123456789012:log-group:/ecs/app"]}`)
+		writeLiveTailEvent(w, "sessionUpdate", fmt.Sprintf(
+			`{"sessionMetadata":{"sampled":false},"sessionResults":[{"logStreamName":"ecs/app/task","message":"live","timestamp":%d}]}`,
+			flextime.Now().UnixMilli(),
+		))
+		<-r.Context().Done()
+	default:
+		http.Error(w, "unknown target", http.StatusBadRequest)
+	}
+}
+
+func writeLiveTailEvent(w http.ResponseWriter, eventType, payload string) {
+	headers := eventstream.Headers{}
+	headers.Set(":message-type", eventstream.StringValue("event"))
+	headers.Set(":event-type", eventstream.StringValue(eventType))
+	headers.Set(":content-type", eventstream.StringValue("application/json"))
+	eventstream.NewEncoder().Encode(w, eventstream.Message{Headers: headers, Payload: []byte(payload)})
+	w.(http.Flusher).Flush()
+}
+
+func newFakeLogsApp(t *testing.T, h http.Handler) *Ecsta {
+	t.Helper()
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	addr := ts.Listener.Addr().String()
+	client := cloudwatchlogs.New(cloudwatchlogs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://logs.test"),
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				// Live Tail requests are sent to the "streaming-" prefixed host
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, addr)
+				},
+			},
+		},
+	})
+	return &Ecsta{logs: client}
+}
+
+func collectLogMessages(t *testing.T, ch <-chan *logRecord, n int) []string {
+	t.Helper()
+	var msgs []string
+	timeout := time.After(10 * time.Second)
+	for len(msgs) < n {
+		select {
+		case r := <-ch:
+			if r.Container != "app" {
+				t.Errorf("unexpected container: %s", r.Container)
+			}
+			msgs = append(msgs, r.Msg)
+		case <-timeout:
+			t.Fatalf("timed out. received %v", msgs)
+		}
+	}
+	return msgs
+}
+
+func TestLiveTailLogs(t *testing.T) {
+	app := newFakeLogsApp(t, &fakeLogsServer{liveTail: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan *logRecord)
+	done := make(chan error)
+	go func() {
+		done <- app.liveTailLogs(ctx, &followOption{
+			logGroup:  "/ecs/app",
+			startTime: flextime.Now().Add(-time.Minute),
+			follow:    true,
+			liveTail:  true,
+			out:       ch,
+		}, []logStream{{group: "/ecs/app", stream: "ecs/app/task", container: "app"}})
+	}()
+	msgs := collectLogMessages(t, ch, 2)
+	if got := strings.Join(msgs, ","); got != "live,history" && got != "history,live" {
+		t.Errorf("unexpected messages: %s", got)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestLiveTailLogsFallback(t *testing.T) {
+	app := newFakeLogsApp(t, &fakeLogsServer{liveTail: false})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan *logRecord)
+	done := make(chan error)
+	go func() {
+		done <- app.liveTailLogs(ctx, &followOption{
+			logGroup:  "/ecs/app",
+			startTime: flextime.Now().Add(-time.Minute),
+			follow:    true,
+			liveTail:  true,
+			out:       ch,
+		}, []logStream{{group: "/ecs/app", stream: "ecs/app/task", container: "app"}})
+	}()
+	// polled by GetLogEvents
+	if msgs := collectLogMessages(t, ch, 1); msgs[0] != "history" {
+		t.Errorf("unexpected messages: %v", msgs)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestLiveTailLogsReconnect(t *testing.T) {
+	defer func(d, m time.Duration) {
+		liveTailReconnectInterval, liveTailMaxReconnectInterval = d, m
+	}(liveTailReconnectInterval, liveTailMaxReconnectInterval)
+	liveTailReconnectInterval = 20 * time.Millisecond
+	liveTailMaxReconnectInterval = time.Second
+
+	s := &fakeLogsServer{liveTail: true, closing: true}
+	app := newFakeLogsApp(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan *logRecord, 100)
+	// log events before sessions are read by FilterLogEvents without waiting
+	err := app.liveTailLogs(ctx, &followOption{
+		logGroup:      "/ecs/app",
+		startTime:     flextime.Now().Add(-time.Minute),
+		follow:        true,
+		liveTail:      true,
+		filterPattern: "ERROR",
+		out:           ch,
+	}, []logStream{{group: "/ecs/app", stream: "ecs/app/task", container: "app"}})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	// reconnected after 20ms, 40ms, 80ms, 160ms, ... without tight loops
+	if n := s.sessions.Load(); n < 2 || n > 6 {
+		t.Errorf("unexpected number of sessions: %d", n)
+	}
+}
+
+func TestTailLogs(t *testing.T) {
+	base := flextime.Now().Add(-time.Minute)
+	// the fake server returns 2 events per page backward from the latest
+	pages := map[string]string{
+		"":    `{"events":[{"message":"e4","timestamp":%[4]d},{"message":"e5","timestamp":%[5]d}],"nextBackwardToken":"b/1","nextForwardToken":"f/1"}`,
+		"b/1": `{"events":[{"message":"e2","timestamp":%[2]d},{"message":"e3","timestamp":%[3]d}],"nextBackwardToken":"b/2","nextForwardToken":"f/2"}`,
+		"b/2": `{"events":[{"message":"e1","timestamp":%[1]d}],"nextBackwardToken":"b/3","nextForwardToken":"f/3"}`,
+		"b/3": `{"events":[],"nextBackwardToken":"b/3","nextForwardToken":"f/4"}`,
+	}
+	app := newFakeLogsApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			NextToken     string `json:"nextToken"`
+			StartFromHead *bool  `json:"startFromHead"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if in.StartFromHead == nil || *in.StartFromHead {
+			http.Error(w, "startFromHead must be false", http.StatusBadRequest)
+			return
+		}
+		ts := make([]any, 5)
+		for i := range ts {
+			ts[i] = base.Add(time.Duration(i) * time.Second).UnixMilli()
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprintf(w, pages[in.NextToken], ts...)
+	}))
+
+	for _, tail := range []int{3, 10} {
+		ch := make(chan *logRecord, 10)
+		_, err := app.tailLogs(context.Background(), &followOption{
+			logGroup:      "/ecs/app",
+			logStream:     "ecs/app/task",
+			containerName: "app",
+			endTime:       flextime.Now(),
+			tail:          tail,
+			out:           ch,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		close(ch)
+		var msgs []string
+		for r := range ch {
+			msgs = append(msgs, r.Msg)
+		}
+		want := "e3,e4,e5"
+		if tail == 10 {
+			want = "e1,e2,e3,e4,e5"
+		}
+		if got := strings.Join(msgs, ","); got != want {
+			t.Errorf("tail %d: got %s, want %s", tail, got, want)
+		}
+	}
+}
+
+func TestWaitQueryResults(t *testing.T) {
+	defer func(d time.Duration) { insightsPollInterval = d }(insightsPollInterval)
+	insightsPollInterval = 10 * time.Millisecond
+
+	var polled atomic.Int32
+	app := newFakeLogsApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if polled.Add(1) < 3 {
+			fmt.Fprint(w, `{"status":"Running","results":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"Complete","results":[[{"field":"count(*)","value":"3"}]],"statistics":{"recordsMatched":3}}`)
+	}))
+	out, err := app.waitQueryResults(context.Background(), "query-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := polled.Load(); n != 3 {
+		t.Errorf("unexpected number of polls: %d", n)
+	}
+	if len(out.Results) != 1 || aws.ToString(out.Results[0][0].Value) != "3" {
+		t.Errorf("unexpected results: %v", out.Results)
+	}
+}
+
+func TestFilterLogsFollow(t *testing.T) {
+	defer func(d time.Duration) { filterLogsPollInterval = d }(filterLogsPollInterval)
+	filterLogsPollInterval = 10 * time.Millisecond
+
+	base := flextime.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	events := []struct {
+		id string
+		ts time.Time
+	}{
+		{"m0", base},
+		{"m1", base.Add(30 * time.Second)},
+	}
+	var mu sync.Mutex
+	var startTimes []time.Time
+	app := newFakeLogsApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			StartTime int64 `json:"startTime"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		start := time.UnixMilli(in.StartTime)
+		mu.Lock()
+		startTimes = append(startTimes, start)
+		mu.Unlock()
+		var es []string
+		for _, e := range events {
+			if !e.ts.Before(start) {
+				es = append(es, fmt.Sprintf(`{"eventId":%q,"message":%q,"timestamp":%d,"logStreamName":"ecs/app/task"}`, e.id, e.id, e.ts.UnixMilli()))
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprintf(w, `{"events":[%s]}`, strings.Join(es, ","))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *logRecord, 10)
+	done := make(chan error)
+	go func() {
+		done <- app.filterLogs(ctx, &followOption{
+			logGroup:      "/ecs/app",
+			startTime:     base,
+			follow:        true,
+			filterPattern: "m",
+			out:           ch,
+		}, []logStream{{group: "/ecs/app", stream: "ecs/app/task", container: "app"}})
+	}()
+	for {
+		mu.Lock()
+		n := len(startTimes)
+		mu.Unlock()
+		if n >= 8 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	var msgs []string
+	for r := range ch {
+		msgs = append(msgs, r.Msg)
+	}
+	if got := strings.Join(msgs, ","); got != "m0,m1" {
+		t.Errorf("unexpected messages: %s", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, st := range startTimes {
+		if st.Before(base) || (i > 0 && st.Before(startTimes[i-1])) {
+			t.Errorf("start time moved backward: %v", startTimes)
+			break
+		}
+	}
+	if want := base.Add(20 * time.Second); !startTimes[len(startTimes)-1].Equal(want) {
+		t.Errorf("unexpected last start time: %s, want %s", startTimes[len(startTimes)-1], want)
+	}
+}
@@ -1,11 +1,23 @@
 package ecsta_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/fujiwara/ecsta"
+	"github.com/google/go-cmp/cmp"
 )
 
 func init() {
@@ -53,9 +65,58 @@ var logsOptionTests = []logsOptionTest{
 		},
 		startTime: time.Date(2023, 2, 10, 11, 17, 33, 0, time.Local),
 	},
+	{
+		title: "since 2 hours ago",
+		opt: &ecsta.LogsOption{
+			Since:    2 * time.Hour,
+			Duration: 1 * time.Minute,
+		},
+		startTime: time.Date(2023, 2, 10, 9, 22, 33, 0, time.Local),
+		endTime:   time.Date(2023, 2, 10, 11, 22, 33, 0, time.Local),
+	},
+	{
+		title: "start time to end time",
+		opt: &ecsta.LogsOption{
+			StartTime: "2023-01-02 11:22",
+			EndTime:   "2023-01-02 12:00",
+			Duration:  1 * time.Minute,
+		},
+		startTime: time.Date(2023, 1, 2, 11, 22, 0, 0, time.Local),
+		endTime:   time.Date(2023, 1, 2, 12, 0, 0, 0, time.Local),
+	},
+	{
+		title: "duration before end time",
+		opt: &ecsta.LogsOption{
+			EndTime:  "2023-01-02 12:00",
+			Duration: 10 * time.Minute,
+		},
+		startTime: time.Date(2023, 1, 2, 11, 50, 0, 0, time.Local),
+		endTime:   time.Date(2023, 1, 2, 12, 0, 0, 0, time.Local),
+	},
+	{
+		title: "tail without start time",
+		opt: &ecsta.LogsOption{
+			Tail:     200,
+			Duration: 1 * time.Minute,
+		},
+		endTime: time.Date(2023, 2, 10, 11, 22, 33, 0, time.Local),
+	},
+	{
+		title: "tail since 2 hours ago",
+		opt: &ecsta.LogsOption{
+			Tail:     200,
+			Since:    2 * time.Hour,
+			Duration: 1 * time.Minute,
+		},
+		startTime: time.Date(2023, 2, 10, 9, 22, 33, 0, time.Local),
+		endTime:   time.Date(2023, 2, 10, 11, 22, 33, 0, time.Local),
+	},
 }
 
 func TestLogOptStartTime(t *testing.T) {
+	// other tests in the package take a while, so fix the clock
+	restore := flextime.Fix(time.Date(2023, 2, 10, 11, 22, 33, 0, time.Local))
+	defer restore()
 	for _, tt := range logsOptionTests {
 		t.Run(tt.title, func(t *testing.T) {
 			startTime, endTime, err := tt.opt.ResolveTimestamps()
@@ -71,3 +132,529 @@ func TestLogOptStartTime(t *testing.T) {
 		})
 	}
 }
+
+func TestLogOptResolveTimestampsError(t *testing.T) {
+	tests := []struct {
+		title string
+		opt   *ecsta.LogsOption
+	}{
+		{
+			title: "start time and since",
+			opt:   &ecsta.LogsOption{StartTime: "2023-01-02 11:22", Since: time.Hour},
+		},
+		{
+			title: "end time and follow",
+			opt:   &ecsta.LogsOption{EndTime: "2023-01-02 11:22", Follow: true},
+		},
+		{
+			title: "end time before start time",
+			opt:   &ecsta.LogsOption{StartTime: "2023-01-02 11:22", EndTime: "2023-01-02 11:00"},
+		},
+		{
+			title: "negative tail",
+			opt:   &ecsta.LogsOption{Tail: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if _, _, err := tt.opt.ResolveTimestamps(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestTaskLogStreams(t *testing.T) {
+	task := types.Task{
+		TaskArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster-name/045a0639-1dc5-4d17-8101-2dd3fd339e91"),
+	}
+	td := &types.TaskDefinition{
+		ContainerDefinitions: []types.ContainerDefinition{
+			{
+				Name: aws.String("app"),
+				LogConfiguration: &types.LogConfiguration{
+					LogDriver: types.LogDriverAwslogs,
+					Options: map[string]string{
+						"awslogs-group":         "/ecs/app",
+						"awslogs-stream-prefix": "ecs",
+					},
+				},
+			},
+			{
+				Name: aws.String("sidecar"),
+			},
+		},
+	}
+	streams, names, notes := ecsta.TaskLogStreams(task, td, "")
+	if diff := cmp.Diff([]string{"/ecs/app ecs/app/045a0639-1dc5-4d17-8101-2dd3fd339e91 app"}, streams); diff != "" {
+		t.Errorf("unexpected streams: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"app", "sidecar"}, names); diff != "" {
+		t.Errorf("unexpected container names: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"sidecar: no log configuration"}, notes); diff != "" {
+		t.Errorf("unexpected notes: %s", diff)
+	}
+	if streams, _, _ := ecsta.TaskLogStreams(task, td, "sidecar"); len(streams) != 0 {
+		t.Errorf("unexpected streams for sidecar: %v", streams)
+	}
+}
+
+func TestTaskLogStreamsFirelens(t *testing.T) {
+	task := types.Task{
+		TaskArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/cluster-name/045a0639-1dc5-4d17-8101-2dd3fd339e91"),
+		ClusterArn:        aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/cluster-name"),
+		TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/app:12"),
+	}
+	firelens := func(name string, opts map[string]string) types.ContainerDefinition {
+		return types.ContainerDefinition{
+			Name: aws.String(name),
+			LogConfiguration: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwsfirelens,
+				Options:   opts,
+			},
+		}
+	}
+	td := &types.TaskDefinition{
+		ContainerDefinitions: []types.ContainerDefinition{
+			firelens("app", map[string]string{
+				"Name":              "cloudwatch_logs",
+				"log_group_name":    "/ecs/$(ecs_cluster)",
+				"log_stream_prefix": "firelens/",
+			}),
+			firelens("worker", map[string]string{
+				"Name":            "cloudwatch",
+				"log_group_name":  "/ecs/worker",
+				"log_stream_name": "$(container_name)/$(ecs_task_id)",
+			}),
+			firelens("unknown", map[string]string{
+				"Name":            "cloudwatch_logs",
+				"log_group_name":  "/ecs/unknown",
+				"log_stream_name": "$(foo)",
+			}),
+			firelens("datadog", map[string]string{"Name": "datadog"}),
+			firelens("custom", nil),
+			{
+				Name:             aws.String("splunk"),
+				LogConfiguration: &types.LogConfiguration{LogDriver: types.LogDriverSplunk},
+			},
+		},
+	}
+	streams, _, notes := ecsta.TaskLogStreams(task, td, "")
+	expectedStreams := []string{
+		"/ecs/cluster-name firelens/app-firelens-045a0639-1dc5-4d17-8101-2dd3fd339e91 app",
+		"/ecs/worker worker/045a0639-1dc5-4d17-8101-2dd3fd339e91 worker",
+	}
+	if diff := cmp.Diff(expectedStreams, streams); diff != "" {
+		t.Errorf("unexpected streams: %s", diff)
+	}
+	expectedNotes := []string{
+		`unknown: awsfirelens cloudwatch_logs to log group /ecs/unknown, log stream "$(foo)" which is not resolved`,
+		"datadog: awsfirelens with output plugin datadog",
+		"custom: awsfirelens with the output defined in the log router configuration file",
+		"splunk: log driver splunk",
+	}
+	if diff := cmp.Diff(expectedNotes, notes); diff != "" {
+		t.Errorf("unexpected notes: %s", diff)
+	}
+}
+
+func TestTaskInLogsRange(t *testing.T) {
+	startTime := time.Date(2023, 2, 10, 11, 0, 0, 0, time.UTC)
+	endTime := time.Date(2023, 2, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		title   string
+		task    types.Task
+		endTime time.Time
+		want    bool
+	}{
+		{
+			title: "running task",
+			task:  types.Task{CreatedAt: aws.Time(startTime.Add(-time.Hour))},
+			want:  true,
+		},
+		{
+			title: "stopped before start time",
+			task: types.Task{
+				CreatedAt: aws.Time(startTime.Add(-time.Hour)),
+				StoppedAt: aws.Time(startTime.Add(-time.Minute)),
+			},
+			want: false,
+		},
+		{
+			title: "stopped after start time",
+			task: types.Task{
+				CreatedAt: aws.Time(startTime.Add(-time.Hour)),
+				StoppedAt: aws.Time(startTime.Add(time.Minute)),
+			},
+			want: true,
+		},
+		{
+			title:   "created after end time",
+			task:    types.Task{CreatedAt: aws.Time(endTime.Add(time.Minute))},
+			endTime: endTime,
+			want:    false,
+		},
+		{
+			title: "created after start time in follow mode",
+			task:  types.Task{CreatedAt: aws.Time(endTime.Add(time.Minute))},
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := ecsta.TaskInLogsRange(tt.task, startTime, tt.endTime); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogTextEncoderWithTask(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := ecsta.NewLogEncoder(buf, false)
+	enc.Encode(&ecsta.LogRecord{Time: "2023-02-10T11:22:33Z", Container: "app", Msg: "hello"})
+	enc.Encode(&ecsta.LogRecord{Time: "2023-02-10T11:22:34Z", Task: "045a0639", Container: "app", Msg: "world"})
+	want := "2023-02-10T11:22:33Z\tapp\thello\n2023-02-10T11:22:34Z\t045a0639\tapp\tworld\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestLogMerger(t *testing.T) {
+	base := time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC)
+	records := []struct {
+		offset    time.Duration
+		container string
+		msg       string
+	}{
+		{2 * time.Second, "app", "app-2"},
+		{0, "app", "app-0"},
+		{1 * time.Second, "sidecar", "sidecar-1"},
+		{2 * time.Second, "sidecar", "sidecar-2"},
+	}
+	tests := []struct {
+		title  string
+		window time.Duration
+		want   string
+	}{
+		{
+			title:  "sorted by timestamp in the window",
+			window: time.Hour,
+			want: "2023-02-10T11:22:33Z\tapp\tapp-0\n" +
+				"2023-02-10T11:22:34Z\tsidecar\tsidecar-1\n" +
+				"2023-02-10T11:22:35Z\tapp\tapp-2\n" +
+				"2023-02-10T11:22:35Z\tsidecar\tsidecar-2\n",
+		},
+		{
+			title:  "arrival order without window",
+			window: 0,
+			want: "2023-02-10T11:22:35Z\tapp\tapp-2\n" +
+				"2023-02-10T11:22:33Z\tapp\tapp-0\n" +
+				"2023-02-10T11:22:34Z\tsidecar\tsidecar-1\n" +
+				"2023-02-10T11:22:35Z\tsidecar\tsidecar-2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			m := ecsta.NewLogMerger(ecsta.NewLogEncoder(buf, false), tt.window)
+			for _, r := range records {
+				m.In() <- ecsta.NewLogRecordAt(base.Add(r.offset), r.container, r.msg)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, buf.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLogMergerFlushAfterWindow(t *testing.T) {
+	buf := &syncBuffer{}
+	m := ecsta.NewLogMerger(ecsta.NewLogEncoder(buf, false), 10*time.Millisecond)
+	base := time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC)
+	m.In() <- ecsta.NewLogRecordAt(base, "app", "hello")
+	time.Sleep(200 * time.Millisecond)
+	// the record is output after the window without Close
+	if got := buf.String(); got != "2023-02-10T11:22:33Z\tapp\thello\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	m.Close()
+}
+
+func TestLogGrepEncoder(t *testing.T) {
+	msgs := []string{"INFO started", "ERROR failed to connect", "WARN retrying", "ERROR timeout"}
+	tests := []struct {
+		title   string
+		grep    string
+		grepV   string
+		want    []string
+		wantErr bool
+	}{
+		{title: "no filters", want: msgs},
+		{title: "grep", grep: "^ERROR", want: []string{"ERROR failed to connect", "ERROR timeout"}},
+		{title: "grep-v", grepV: "^(INFO|WARN)", want: []string{"ERROR failed to connect", "ERROR timeout"}},
+		{title: "grep and grep-v", grep: "ERROR|WARN", grepV: "timeout", want: []string{"ERROR failed to connect", "WARN retrying"}},
+		{title: "invalid grep", grep: "(", wantErr: true},
+		{title: "invalid grep-v", grepV: "[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			enc, err := ecsta.NewLogGrepEncoder(ecsta.NewLogEncoder(buf, true), tt.grep, tt.grepV)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			for _, msg := range msgs {
+				enc.Encode(&ecsta.LogRecord{Msg: msg})
+			}
+			var got []string
+			dec := json.NewDecoder(buf)
+			for dec.More() {
+				var r ecsta.LogRecord
+				if err := dec.Decode(&r); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, r.Msg)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLogJSONParseEncoder(t *testing.T) {
+	msgs := []string{
+		`{"level":"info","msg":"started","port":8080}`,
+		`plain text message`,
+		`{"level":"error","msg":"failed"}`,
+		`{broken json`,
+	}
+	tests := []struct {
+		title string
+		json  bool
+		query string
+		want  string
+	}{
+		{
+			title: "nested in JSON output",
+			json:  true,
+			want: `{"time":"t","container":"app","msg":{"level":"info","msg":"started","port":8080}}` + "\n" +
+				`{"time":"t","container":"app","msg":"plain text message"}` + "\n" +
+				`{"time":"t","container":"app","msg":{"level":"error","msg":"failed"}}` + "\n" +
+				`{"time":"t","container":"app","msg":"{broken json"}` + "\n",
+		},
+		{
+			title: "text output is untouched without query",
+			want: "t\tapp\t{\"level\":\"info\",\"msg\":\"started\",\"port\":8080}\n" +
+				"t\tapp\tplain text message\n" +
+				"t\tapp\t{\"level\":\"error\",\"msg\":\"failed\"}\n" +
+				"t\tapp\t{broken json\n",
+		},
+		{
+			title: "query to string",
+			query: `.level + " " + .msg`,
+			want: "t\tapp\tinfo started\n" +
+				"t\tapp\tplain text message\n" +
+				"t\tapp\terror failed\n" +
+				"t\tapp\t{broken json\n",
+		},
+		{
+			title: "query selects and outputs objects",
+			json:  true,
+			query: `select(.level == "error") | {msg}`,
+			want: `{"time":"t","container":"app","msg":"plain text message"}` + "\n" +
+				`{"time":"t","container":"app","msg":{"msg":"failed"}}` + "\n" +
+				`{"time":"t","container":"app","msg":"{broken json"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			enc, err := ecsta.NewLogJSONParseEncoder(ecsta.NewLogEncoder(buf, tt.json), true, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, msg := range msgs {
+				if err := enc.Encode(&ecsta.LogRecord{Time: "t", Container: "app", Msg: msg}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if diff := cmp.Diff(tt.want, buf.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+	if _, err := ecsta.NewLogJSONParseEncoder(ecsta.NewLogEncoder(&bytes.Buffer{}, false), true, ".["); err == nil {
+		t.Error("expected error for invalid query")
+	}
+}
+
+func TestInsightsQueryString(t *testing.T) {
+	q := ecsta.InsightsQueryString([]string{"ecs/app/1", "ecs/web/1", "ecs/app/1"}, "stats count(*) by bin(1m)")
+	expected := "filter @logStream in [\"ecs/app/1\", \"ecs/web/1\"]\n| stats count(*) by bin(1m)"
+	if q != expected {
+		t.Errorf("unexpected query: %s", q)
+	}
+}
+
+func TestInsightsResultRows(t *testing.T) {
+	field := func(f, v string) logsTypes.ResultField {
+		return logsTypes.ResultField{Field: aws.String(f), Value: aws.String(v)}
+	}
+	columns, rows := ecsta.InsightsResultRows([][]logsTypes.ResultField{
+		{field("bin(1m)", "2023-02-10 11:00:00.000"), field("count(*)", "3")},
+		{field("bin(1m)", "2023-02-10 11:01:00.000"), field("@ptr", "xxx"), field("level", "error")},
+	})
+	if diff := cmp.Diff([]string{"bin(1m)", "count(*)", "level"}, columns); diff != "" {
+		t.Errorf("unexpected columns: %s", diff)
+	}
+	expected := [][]string{
+		{"2023-02-10 11:00:00.000", "3", ""},
+		{"2023-02-10 11:01:00.000", "", "error"},
+	}
+	if diff := cmp.Diff(expected, rows); diff != "" {
+		t.Errorf("unexpected rows: %s", diff)
+	}
+}
+
+func TestLogFileEncoder(t *testing.T) {
+	ts := time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC)
+	records := []*ecsta.LogRecord{
+		ecsta.NewLogRecordAt(ts, "app", "hello"),
+		ecsta.NewLogRecordAt(ts, "sidecar", "world"),
+		ecsta.NewLogRecordAt(ts, "app", "line1\nline2"),
+	}
+	records[1].Task = "045a0639"
+
+	t.Run("per container", func(t *testing.T) {
+		dir := t.TempDir()
+		enc := ecsta.NewLogFileEncoder(dir, false, false, false)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		summary, err := enc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []ecsta.LogFileSummary{
+			{Path: filepath.Join(dir, "app.log"), Lines: 3},
+			{Path: filepath.Join(dir, "sidecar.log"), Lines: 1},
+		}
+		if diff := cmp.Diff(expected, summary); diff != "" {
+			t.Errorf("unexpected summary: %s", diff)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "app.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != "2023-02-10T11:22:33Z\tapp\thello\n2023-02-10T11:22:33Z\tapp\tline1\nline2\n" {
+			t.Errorf("unexpected content: %q", s)
+		}
+	})
+
+	t.Run("per task with gzip", func(t *testing.T) {
+		dir := t.TempDir()
+		enc := ecsta.NewLogFileEncoder(dir, true, true, true)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		summary, err := enc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "045a0639", "sidecar.log.gz")
+		expected := []ecsta.LogFileSummary{
+			{Path: filepath.Join(dir, "app.log.gz"), Lines: 2},
+			{Path: path, Lines: 1},
+		}
+		if diff := cmp.Diff(expected, summary); diff != "" {
+			t.Errorf("unexpected summary: %s", diff)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != `{"time":"2023-02-10T11:22:33Z","task":"045a0639","container":"sidecar","msg":"world"}`+"\n" {
+			t.Errorf("unexpected content: %q", s)
+		}
+	})
+}
+
+func TestLogPrettyEncoder(t *testing.T) {
+	restore := flextime.Fix(time.Date(2023, 2, 10, 11, 22, 33, 0, time.UTC))
+	defer restore()
+	ts := time.Date(2023, 2, 10, 11, 20, 13, 0, time.UTC)
+
+	buf := &bytes.Buffer{}
+	enc := ecsta.NewLogPrettyEncoder(buf, true)
+	app1 := ecsta.NewLogRecordAt(ts, "app", "ERROR: something wrong")
+	sidecar := ecsta.NewLogRecordAt(ts, "sidecar", `{"level":"warn","msg":"slow"}`)
+	app2 := ecsta.NewLogRecordAt(ts, "app", "ok")
+	for _, r := range []*ecsta.LogRecord{app1, sidecar, app2} {
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "\x1b[2m2m20s ago\x1b[0m ") {
+		t.Errorf("unexpected relative timestamp: %q", lines[0])
+	}
+	if !strings.Contains(lines[0], "\x1b[1;31mERROR\x1b[0m: something wrong") {
+		t.Errorf("ERROR is not highlighted: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "\"\x1b[1;33mlevel\":\"warn\x1b[0m\"") {
+		t.Errorf("warn level is not highlighted: %q", lines[1])
+	}
+	// the same container has the same color
+	color := func(line string) string {
+		return strings.SplitN(strings.SplitN(line, "\x1b[0m \x1b[", 2)[1], "m", 2)[0]
+	}
+	if color(lines[0]) != color(lines[2]) {
+		t.Errorf("colors of app differ: %q %q", lines[0], lines[2])
+	}
+	// labels are aligned to the longest one
+	if !strings.Contains(lines[2], "app    \x1b[0m | ok") {
+		t.Errorf("label is not aligned: %q", lines[2])
+	}
+}
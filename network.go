@@ -0,0 +1,166 @@
+package ecsta
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/samber/lo"
+)
+
+// taskNetworkInterface is a network interface attached to a task in the awsvpc network mode.
+type taskNetworkInterface struct {
+	ID          string
+	Subnet      string
+	PrivateIPv4 string
+	PrivateIPv6 string
+	MAC         string
+	PrivateDNS  string
+}
+
+// taskNetworkInterfaces returns the network interfaces in the attachments of the task.
+func taskNetworkInterfaces(task types.Task) []taskNetworkInterface {
+	var nis []taskNetworkInterface
+	for _, a := range task.Attachments {
+		if aws.ToString(a.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+		var ni taskNetworkInterface
+		for _, d := range a.Details {
+			v := aws.ToString(d.Value)
+			switch aws.ToString(d.Name) {
+			case "networkInterfaceId":
+				ni.ID = v
+			case "subnetId":
+				ni.Subnet = v
+			case "privateIPv4Address":
+				ni.PrivateIPv4 = v
+			case "ipv6Address", "privateIPv6Address":
+				ni.PrivateIPv6 = v
+			case "macAddress":
+				ni.MAC = v
+			case "privateDnsName":
+				ni.PrivateDNS = v
+			}
+		}
+		if ni.PrivateIPv6 == "" {
+			// IPv6 addresses may be reported only in the network interfaces of containers
+			for _, c := range task.Containers {
+				for _, cni := range c.NetworkInterfaces {
+					if aws.ToString(cni.AttachmentId) == aws.ToString(a.Id) && cni.Ipv6Address != nil {
+						ni.PrivateIPv6 = aws.ToString(cni.Ipv6Address)
+					}
+				}
+			}
+		}
+		nis = append(nis, ni)
+	}
+	return nis
+}
+
+// taskNetworkColumn returns an extractor of the field of the first network interface of the task.
+func taskNetworkColumn(field func(taskNetworkInterface) string) taskColumnFunc {
+	return func(task types.Task) string {
+		if nis := taskNetworkInterfaces(task); len(nis) > 0 {
+			return field(nis[0])
+		}
+		return ""
+	}
+}
+
+// ec2NetworkColumns are the columns which require the EC2 API.
+var ec2NetworkColumns = []string{"PublicIP", "SecurityGroups"}
+
+// ec2NetworkColumn returns an extractor of the network interface of the task described by the EC2 API.
+func ec2NetworkColumn(interfaces map[string]ec2Types.NetworkInterface, field func(ec2Types.NetworkInterface) string) taskColumnFunc {
+	return func(task types.Task) string {
+		for _, ni := range taskNetworkInterfaces(task) {
+			if eni, ok := interfaces[ni.ID]; ok {
+				return field(eni)
+			}
+		}
+		return ""
+	}
+}
+
+func eniPublicIP(eni ec2Types.NetworkInterface) string {
+	if eni.Association == nil {
+		return ""
+	}
+	return aws.ToString(eni.Association.PublicIp)
+}
+
+func eniSecurityGroups(eni ec2Types.NetworkInterface) string {
+	return strings.Join(lo.Map(eni.Groups, func(g ec2Types.GroupIdentifier, _ int) string {
+		return aws.ToString(g.GroupId)
+	}), ",")
+}
+
+// describeNetworkInterfacesMax is the maximum number of network interfaces in a DescribeNetworkInterfaces call.
+const describeNetworkInterfacesMax = 200
+
+// describeTaskNetworkInterfaces describes the network interfaces of the tasks by the EC2 API.
+func (app *Ecsta) describeTaskNetworkInterfaces(ctx context.Context, tasks []types.Task) (map[string]ec2Types.NetworkInterface, error) {
+	var ids []string
+	for _, task := range tasks {
+		for _, ni := range taskNetworkInterfaces(task) {
+			if ni.ID != "" {
+				ids = append(ids, ni.ID)
+			}
+		}
+	}
+	interfaces := map[string]ec2Types.NetworkInterface{}
+	for _, chunk := range lo.Chunk(lo.Uniq(ids), describeNetworkInterfacesMax) {
+		// Filter by IDs instead of NetworkInterfaceIds not to fail by interfaces already deleted
+		p := ec2.NewDescribeNetworkInterfacesPaginator(app.ec2, &ec2.DescribeNetworkInterfacesInput{
+			Filters: []ec2Types.Filter{{Name: aws.String("network-interface-id"), Values: chunk}},
+		})
+		for p.HasMorePages() {
+			out, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe network interfaces: %w", err)
+			}
+			for _, eni := range out.NetworkInterfaces {
+				interfaces[aws.ToString(eni.NetworkInterfaceId)] = eni
+			}
+		}
+	}
+	return interfaces, nil
+}
+
+// describeNetwork writes a summary of the network interfaces of the task.
+// Public IPs and security groups are shown when the EC2 API is available.
+func (app *Ecsta) describeNetwork(ctx context.Context, task types.Task) error {
+	nis := taskNetworkInterfaces(task)
+	if len(nis) == 0 {
+		return fmt.Errorf("task %s has no network interfaces. the network mode is not awsvpc", arnToName(*task.TaskArn))
+	}
+	interfaces, err := app.describeTaskNetworkInterfaces(ctx, []types.Task{task})
+	if err != nil {
+		slog.Warn("public IPs and security groups are not shown", "error", err)
+	}
+	columns := []string{"ENI", "Subnet", "PrivateIPv4", "PrivateIPv6", "PrivateDNS", "MAC", "PublicIP", "SecurityGroups"}
+	f, err := newRowFormatter(app.w, app.Config.Output, columns)
+	if err != nil {
+		return err
+	}
+	for _, ni := range nis {
+		eni := interfaces[ni.ID]
+		f.AddRow([]string{ni.ID, ni.Subnet, ni.PrivateIPv4, ni.PrivateIPv6, ni.PrivateDNS, ni.MAC, eniPublicIP(eni), eniSecurityGroups(eni)})
+	}
+	f.Close()
+	return nil
+}
+
+// needsEC2NetworkColumns reports whether the columns require the EC2 API.
+func needsEC2NetworkColumns(columns []string) bool {
+	return slices.ContainsFunc(columns, func(col string) bool {
+		return slices.Contains(ec2NetworkColumns, col)
+	})
+}
@@ -0,0 +1,116 @@
+package ecsta
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadTestTask(t *testing.T) types.Task {
+	t.Helper()
+	b, err := os.ReadFile("testdata/task.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var task types.Task
+	if err := UnmarshalJSONForStruct(b, &task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestTaskNetworkInterfaces(t *testing.T) {
+	task := loadTestTask(t)
+	expected := []taskNetworkInterface{
+		{
+			ID:          "eni-022defbcdec55036b",
+			Subnet:      "subnet-04b750544ddd71274",
+			PrivateIPv4: "10.3.1.230",
+			MAC:         "06:63:69:5b:38:1f",
+		},
+	}
+	if diff := cmp.Diff(expected, taskNetworkInterfaces(task)); diff != "" {
+		t.Errorf("unexpected network interfaces: %s", diff)
+	}
+	if nis := taskNetworkInterfaces(types.Task{}); len(nis) != 0 {
+		t.Errorf("unexpected network interfaces for a task without attachments: %v", nis)
+	}
+}
+
+// fakeEC2Server is a fake EC2 API server returning a network interface for the filter.
+func fakeEC2Server(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "DescribeNetworkInterfaces" {
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<DescribeNetworkInterfacesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+<requestId>req-1</requestId>
+<networkInterfaceSet><item>
+<networkInterfaceId>%s</networkInterfaceId>
+<association><publicIp>203.0.113.10</publicIp></association>
+<groupSet><item><groupId>sg-1</groupId><groupName>web</groupName></item><item><groupId>sg-2</groupId><groupName>ssh</groupName></item></groupSet>
+</item></networkInterfaceSet>
+</DescribeNetworkInterfacesResponse>`, r.Form.Get("Filter.1.Value.1"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestDescribeNetwork(t *testing.T) {
+	ts := fakeEC2Server(t)
+	buf := &strings.Builder{}
+	app := &Ecsta{
+		Config: &Config{Output: "tsv"},
+		w:      buf,
+		ec2: ec2.New(ec2.Options{
+			Region:       "ap-northeast-1",
+			BaseEndpoint: aws.String(ts.URL),
+			Credentials:  aws.AnonymousCredentials{},
+		}),
+	}
+	task := loadTestTask(t)
+	if err := app.describeNetwork(t.Context(), task); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ENI\tSubnet\tPrivateIPv4\tPrivateIPv6\tPrivateDNS\tMAC\tPublicIP\tSecurityGroups\n" +
+		"eni-022defbcdec55036b\tsubnet-04b750544ddd71274\t10.3.1.230\t\t\t06:63:69:5b:38:1f\t203.0.113.10\tsg-1,sg-2\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected output: %s", diff)
+	}
+
+	interfaces, err := app.describeTaskNetworkInterfaces(t.Context(), []types.Task{task})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	f, err := newTaskFormatter(buf, formatterOption{
+		Format:     "tsv",
+		Columns:    []string{"ID", "ENI", "Subnet", "PrivateIP", "PublicIP", "SecurityGroups"},
+		Interfaces: interfaces,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.AddTask(task)
+	f.Close()
+	expected = "4deeb701c49a4892b7de39a2d0df17e0\teni-022defbcdec55036b\tsubnet-04b750544ddd71274\t10.3.1.230\t203.0.113.10\tsg-1,sg-2\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected output: %s", diff)
+	}
+
+	if err := app.describeNetwork(t.Context(), types.Task{TaskArn: aws.String("task/c/bridge")}); err == nil {
+		t.Error("expected an error for a task without network interfaces")
+	}
+}
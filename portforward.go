@@ -1,12 +1,19 @@
 package ecsta
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,18 +22,40 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/samber/lo"
 )
 
+const (
+	// portforwardOpenedMessage is the message that Session Manager Plugin outputs with the local port number.
+	// e.g. "Port 54321 opened for sessionId xxxx."
+	portforwardOpenedMessage = "opened for sessionId"
+	// portforwardReadyMessage is the message that Session Manager Plugin outputs when it is ready for connections.
+	portforwardReadyMessage = "Waiting for connections"
+)
+
+var errPortforwardNotReady = errors.New("port forwarding is not ready")
+
 type PortforwardOption struct {
-	ID         string  `help:"task ID"`
-	Container  string  `help:"container name"`
-	LocalPort  int     `help:"local port"`
-	RemotePort int     `help:"remote port"`
-	RemoteHost string  `help:"remote host"`
-	L          string  `name:"L" help:"short expression of local-port:remote-host:remote-port" short:"L"`
-	Family     *string `help:"task definition family name"`
-	Service    *string `help:"ECS service name. When combined with --family, tasks of other services sharing the family are excluded."`
-	Public     bool    `help:"bind to all interfaces (0.0.0.0) instead of localhost only"`
+	ID          string  `help:"task ID"`
+	Container   string  `help:"container name"`
+	LocalPort   int     `help:"local port. defaults to the remote port when it is available"`
+	RemotePort  int     `help:"remote port. inferred from the port mappings of the container when omitted"`
+	RemoteHost  string  `help:"remote host"`
+	L           string  `name:"L" help:"short expression of local-port:remote-host:remote-port" short:"L"`
+	Family      *string `help:"task definition family name"`
+	Service     *string `help:"ECS service name. When combined with --family, tasks of other services sharing the family are excluded."`
+	Public      bool    `help:"bind to all interfaces (0.0.0.0) instead of localhost only"`
+	LocalSocket string  `help:"listen on a unix domain socket path instead of a local TCP port"`
+	AllTasks    bool    `help:"forward to all running tasks of the service or family with load balancing"`
+	Balance     string  `help:"load balancing strategy for --all-tasks (round-robin, least-conn)" default:"round-robin" enum:"round-robin,least-conn"`
+
+	HTTP       bool     `help:"run an HTTP reverse proxy in front of the port forwarding"`
+	HostHeader string   `help:"override the Host header of requests in --http mode"`
+	AddHeader  []string `help:"add a header to requests in --http mode (e.g. 'Authorization: Bearer xxx'). can be specified multiple times" sep:"none"`
+
+	ReadyFile      string        `help:"write the local address as JSON to the file when the port forwarding is ready"`
+	PrintReadyJSON bool          `help:"print the local address as JSON to stdout when the port forwarding is ready"`
+	ReadyTimeout   time.Duration `help:"exit with an error when the port forwarding is not ready within the timeout. effective with --ready-file or --print-ready-json" default:"1m"`
 
 	stdout io.Writer
 	stderr io.Writer
@@ -49,15 +78,46 @@ func (opt *PortforwardOption) ParseL() error {
 	} else {
 		opt.LocalPort = 0 // use ephemeral port
 	}
+	opt.RemoteHost = parts[1]
+	if parts[2] == "" {
+		opt.RemotePort = 0 // infer from port mappings
+		return nil
+	}
 	remotePort, err := strconv.Atoi(parts[2])
 	if err != nil {
 		return fmt.Errorf("invalid remote port: %s", parts[2])
 	}
-	opt.RemoteHost = parts[1]
 	opt.RemotePort = remotePort
 	return nil
 }
 
+// useProxy reports whether the local proxy runs in front of Session Manager Plugin.
+func (opt *PortforwardOption) useProxy() bool {
+	return opt.Public || opt.LocalSocket != "" || opt.HTTP
+}
+
+// localPortSpecified reports whether the local port is given explicitly by --local-port or -L.
+func (opt *PortforwardOption) localPortSpecified() bool {
+	return opt.LocalPort != 0 || opt.L != ""
+}
+
+// bindAddress returns the address that the local port is bound to.
+func (opt *PortforwardOption) bindAddress() string {
+	if opt.Public {
+		return "0.0.0.0"
+	}
+	return "127.0.0.1"
+}
+
+// pluginStdout returns the writer for the output of Session Manager Plugin.
+// With --print-ready-json, it is written to stderr to keep stdout only for the ready JSON.
+func (opt *PortforwardOption) pluginStdout() io.Writer {
+	if opt.PrintReadyJSON {
+		return opt.stderr
+	}
+	return opt.stdout
+}
+
 func (app *Ecsta) RunPortforward(ctx context.Context, opt *PortforwardOption) error {
 	if opt.stdout == nil {
 		opt.stdout = os.Stdout
@@ -69,13 +129,38 @@ func (app *Ecsta) RunPortforward(ctx context.Context, opt *PortforwardOption) er
 	if err := opt.ParseL(); err != nil {
 		return err
 	}
-	if opt.RemotePort == 0 {
-		return fmt.Errorf("remote-port must be specified")
+	if opt.RemotePort == 0 && opt.RemoteHost != "" {
+		return fmt.Errorf("remote-port must be specified with remote-host")
+	}
+	if opt.LocalSocket != "" {
+		if opt.Public {
+			return fmt.Errorf("local-socket and public cannot be specified at the same time")
+		}
+		if opt.LocalPort != 0 {
+			return fmt.Errorf("local-socket and local-port cannot be specified at the same time")
+		}
+	}
+	if !opt.HTTP && (opt.HostHeader != "" || len(opt.AddHeader) > 0) {
+		return fmt.Errorf("host-header and add-header require http")
+	}
+	if _, err := parseHTTPHeaders(opt.AddHeader); err != nil {
+		return err
+	}
+	if opt.AllTasks {
+		if opt.ID != "" {
+			return fmt.Errorf("all-tasks and id cannot be specified at the same time")
+		}
+		if opt.Service == nil && opt.Family == nil {
+			return fmt.Errorf("all-tasks requires service or family")
+		}
 	}
 
 	if err := app.SetCluster(ctx); err != nil {
 		return err
 	}
+	if opt.AllTasks {
+		return app.runPortforwardAllTasks(ctx, opt)
+	}
 	task, err := app.findTask(ctx, &optionFindTask{
 		id: opt.ID, family: opt.Family, service: opt.Service,
 		selectFunc: selectFuncExcludeStopped,
@@ -83,39 +168,182 @@ func (app *Ecsta) RunPortforward(ctx context.Context, opt *PortforwardOption) er
 	if err != nil {
 		return fmt.Errorf("failed to select tasks: %w", err)
 	}
-
-	name, err := app.findContainerName(ctx, task, opt.Container)
-	if err != nil {
-		return fmt.Errorf("failed to select containers: %w", err)
+	if err := app.preparePortforward(ctx, task, opt); err != nil {
+		return err
 	}
-	opt.Container = name
 
-	target, err := ssmRequestTarget(task, opt.Container)
-	if err != nil {
-		return fmt.Errorf("failed to build ssm request parameters: %w", err)
-	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	readiness := newPortforwardReadiness(opt)
+	defer readiness.cleanup()
+	go readiness.watch(ctx, cancel)
 
-	// Determine local port for Session Manager Plugin
+	taskIDs := []string{arnToName(*task.TaskArn)}
+	var stdout io.Writer
 	var ssmLocalPort int
-	if opt.Public {
-		// Get a specific ephemeral port for Session Manager Plugin when binding to all interfaces
-		listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if opt.useProxy() {
+		// Get a specific ephemeral port for Session Manager Plugin when the proxy is in front of it
+		ssmLocalPort, err = ephemeralLocalPort()
 		if err != nil {
-			return fmt.Errorf("failed to find available port: %w", err)
+			return err
 		}
-		ssmLocalPort = listener.Addr().(*net.TCPAddr).Port
-		listener.Close()
+		slog.Info("Session Manager Plugin will use port", "port", ssmLocalPort)
+
+		// Start proxy in background
+		listener, err := app.listenProxy(opt)
+		if err != nil {
+			return err
+		}
+		backends := newProxyBackends(proxyBalanceRoundRobin)
+		backends.add(taskIDs[0], ssmLocalPort)
+		go app.servePortforwardProxy(ctx, opt, listener, backends)
+
+		// the proxy is ready when Session Manager Plugin is ready for connections
+		stdout = newLineWatcher(opt.pluginStdout(), portforwardReadyMessage, func(string) {
+			readiness.notify(newPortforwardReady(listener.Addr(), opt, taskIDs))
+		})
 	} else {
 		// Use user-specified port for normal case
 		ssmLocalPort = opt.LocalPort
+
+		// Session Manager Plugin reports the actual port when it listens on an ephemeral port
+		boundPort := ssmLocalPort
+		stdout = newLineWatcher(opt.pluginStdout(), portforwardReadyMessage, func(string) {
+			addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: boundPort}
+			readiness.notify(newPortforwardReady(addr, opt, taskIDs))
+		})
+		stdout = newLineWatcher(stdout, portforwardOpenedMessage, func(line string) {
+			if port := parsePortforwardOpenedPort(line); port != 0 {
+				boundPort = port
+			}
+		})
 	}
 
+	sess, target, err := app.startPortforwardSession(ctx, task, opt, ssmLocalPort)
+	if err != nil {
+		return err
+	}
+
+	// Run Session Manager Plugin (common path)
+	err = app.runSessionManagerPlugin(ctx, &task, sess, target, stdout, opt.stderr)
+	if cause := context.Cause(ctx); errors.Is(cause, errPortforwardNotReady) {
+		return cause
+	}
+	return err
+}
+
+// runPortforwardAllTasks starts port forwarding sessions to all running tasks and
+// balances incoming connections across them by the local proxy.
+func (app *Ecsta) runPortforwardAllTasks(ctx context.Context, opt *PortforwardOption) error {
+	tasks, err := app.listTasks(ctx, app.cluster, &optionListTasks{
+		family:   opt.Family,
+		service:  opt.Service,
+		statuses: []types.DesiredStatus{types.DesiredStatusRunning},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	tasks = lo.Filter(tasks, func(task types.Task, _ int) bool {
+		return aws.ToString(task.LastStatus) == "RUNNING"
+	})
+	if len(tasks) == 0 {
+		return fmt.Errorf("no running tasks found")
+	}
+	if err := app.preparePortforward(ctx, tasks[0], opt); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	readiness := newPortforwardReadiness(opt)
+	defer readiness.cleanup()
+	go readiness.watch(ctx, cancel)
+
+	listener, err := app.listenProxy(opt)
+	if err != nil {
+		return err
+	}
+	backends := newProxyBackends(opt.Balance)
+	go app.servePortforwardProxy(ctx, opt, listener, backends)
+
+	taskIDs := lo.Map(tasks, func(task types.Task, _ int) string {
+		return arnToName(*task.TaskArn)
+	})
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		taskID := arnToName(*task.TaskArn)
+		port, err := ephemeralLocalPort()
+		if err != nil {
+			return err
+		}
+		sess, target, err := app.startPortforwardSession(ctx, task, opt, port)
+		if err != nil {
+			slog.Warn("failed to start port forwarding session", "task", taskID, "error", err)
+			continue
+		}
+		// add the backend when Session Manager Plugin is ready for connections
+		stdout := newLineWatcher(opt.pluginStdout(), portforwardReadyMessage, func(string) {
+			if backends.add(taskID, port) {
+				slog.Info("backend is ready", "task", taskID, "port", port)
+				readiness.notify(newPortforwardReady(listener.Addr(), opt, taskIDs))
+			}
+		})
+		wg.Go(func() {
+			if err := app.runSessionManagerPlugin(ctx, &task, sess, target, stdout, opt.stderr); err != nil {
+				slog.Warn("port forwarding session ended", "task", taskID, "error", err)
+			}
+			backends.remove(taskID)
+			slog.Info("backend is removed", "task", taskID, "remaining", backends.len())
+		})
+	}
+
+	wg.Wait()
+	if cause := context.Cause(ctx); errors.Is(cause, errPortforwardNotReady) {
+		return cause
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("all port forwarding sessions are closed")
+}
+
+// preparePortforward resolves the container, remote port and local port of the port forwarding to the task.
+func (app *Ecsta) preparePortforward(ctx context.Context, task types.Task, opt *PortforwardOption) error {
+	name, err := app.findContainerName(ctx, task, opt.Container)
+	if err != nil {
+		return fmt.Errorf("failed to select containers: %w", err)
+	}
+	opt.Container = name
+
+	if opt.RemotePort == 0 {
+		port, err := app.findRemotePort(ctx, task, opt.Container)
+		if err != nil {
+			return err
+		}
+		opt.RemotePort = port
+	}
+	if opt.LocalSocket == "" && !opt.localPortSpecified() {
+		if isPortAvailable(opt.bindAddress(), opt.RemotePort) {
+			opt.LocalPort = opt.RemotePort
+		} else {
+			slog.Info("remote port is not available on local, use an ephemeral port", "port", opt.RemotePort)
+		}
+	}
+	return nil
+}
+
+// startPortforwardSession starts a port forwarding session to the task that Session Manager Plugin listens on localPort.
+func (app *Ecsta) startPortforwardSession(ctx context.Context, task types.Task, opt *PortforwardOption, localPort int) (*types.Session, string, error) {
+	target, err := ssmRequestTarget(task, opt.Container)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build ssm request parameters: %w", err)
+	}
 	in := &ssm.StartSessionInput{
 		Target:       aws.String(target),
 		DocumentName: aws.String("AWS-StartPortForwardingSession"),
 		Parameters: map[string][]string{
 			"portNumber":      {strconv.Itoa(opt.RemotePort)},
-			"localPortNumber": {strconv.Itoa(ssmLocalPort)},
+			"localPortNumber": {strconv.Itoa(localPort)},
 		},
 		Reason: aws.String("port forwarding"),
 	}
@@ -125,44 +353,180 @@ func (app *Ecsta) RunPortforward(ctx context.Context, opt *PortforwardOption) er
 	}
 	res, err := app.ssm.StartSession(ctx, in)
 	if err != nil {
-		return fmt.Errorf("failed to start session: %w", err)
+		return nil, "", fmt.Errorf("failed to start session: %w", err)
 	}
-	sess := &types.Session{
+	return &types.Session{
 		SessionId:  res.SessionId,
 		StreamUrl:  res.StreamUrl,
 		TokenValue: res.TokenValue,
+	}, target, nil
+}
+
+// servePortforwardProxy serves the local proxy in front of Session Manager Plugin according to the option.
+func (app *Ecsta) servePortforwardProxy(ctx context.Context, opt *PortforwardOption, listener net.Listener, backends *proxyBackends) error {
+	if opt.HTTP {
+		handler, err := newHTTPProxyHandler(opt, backends)
+		if err != nil {
+			return err
+		}
+		return app.serveHTTPProxy(ctx, listener, handler)
 	}
+	return app.serveProxy(ctx, listener, backends)
+}
 
-	// Start TCP proxy if public access is requested
+// listenProxy listens on the local address of the proxy in front of Session Manager Plugin according to the option.
+func (app *Ecsta) listenProxy(opt *PortforwardOption) (net.Listener, error) {
+	if opt.LocalSocket != "" {
+		listener, err := listenUnixProxy(opt.LocalSocket)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("unix domain socket proxy listening", "path", opt.LocalSocket)
+		return listener, nil
+	}
 	if opt.Public {
 		slog.Warn("TCP proxy will bind to all interfaces (0.0.0.0) - ensure proper network security", "port", opt.LocalPort)
-		slog.Info("Session Manager Plugin will use port", "port", ssmLocalPort)
+	}
+	listener, err := listenTCPProxy(opt.bindAddress(), opt.LocalPort)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("TCP proxy listening", "address", listener.Addr().String())
+	return listener, nil
+}
 
-		// Start TCP proxy in background
-		go func() {
-			if err := app.startTCPProxyToLocalhost(ctx, "0.0.0.0", opt.LocalPort, ssmLocalPort); err != nil {
-				slog.Error("TCP proxy failed", "error", err)
+// ephemeralLocalPort returns an available ephemeral port on localhost.
+func ephemeralLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find available port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// findRemotePort finds a container port from the port mappings of the container in the task definition.
+// When the container has multiple port mappings, a port is selected by the filter.
+func (app *Ecsta) findRemotePort(ctx context.Context, task types.Task, container string) (int, error) {
+	td, err := app.describeTaskDefinition(ctx, task)
+	if err != nil {
+		return 0, err
+	}
+	mappings := containerPortMappings(td, container)
+	switch len(mappings) {
+	case 0:
+		return 0, fmt.Errorf("remote-port must be specified. no port mappings found in container %s", container)
+	case 1:
+		port := int(aws.ToInt32(mappings[0].ContainerPort))
+		slog.Info("remote port is inferred from the port mappings", "container", container, "port", port)
+		return port, nil
+	}
+	lines := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		lines = append(lines, formatPortMapping(m))
+	}
+	res, err := app.selectByFilter(ctx, lines, "remote port")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(res)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("remote port not selected")
+	}
+	port, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid remote port: %s", fields[0])
+	}
+	return port, nil
+}
+
+// containerPortMappings returns the port mappings that have a container port of the named container.
+func containerPortMappings(td *types.TaskDefinition, container string) []types.PortMapping {
+	var mappings []types.PortMapping
+	for _, c := range td.ContainerDefinitions {
+		if aws.ToString(c.Name) != container {
+			continue
+		}
+		for _, m := range c.PortMappings {
+			if aws.ToInt32(m.ContainerPort) == 0 {
+				continue // port range mapping
 			}
-		}()
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings
+}
 
-		// Wait a bit for proxy to start
-		time.Sleep(200 * time.Millisecond)
+func formatPortMapping(m types.PortMapping) string {
+	ss := []string{strconv.Itoa(int(aws.ToInt32(m.ContainerPort)))}
+	if m.Protocol != "" {
+		ss = append(ss, string(m.Protocol))
 	}
+	if name := aws.ToString(m.Name); name != "" {
+		ss = append(ss, name)
+	}
+	return strings.Join(ss, "\t")
+}
 
-	// Run Session Manager Plugin (common path)
-	return app.runSessionManagerPlugin(ctx, &task, sess, target, opt.stdout, opt.stderr)
+// isPortAvailable reports whether the port can be listened on the address.
+func isPortAvailable(address string, port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
 }
 
-// startTCPProxyToLocalhost starts a TCP proxy that listens on bindAddress:frontendPort and forwards to 127.0.0.1:backendPort
-func (app *Ecsta) startTCPProxyToLocalhost(ctx context.Context, bindAddress string, frontendPort, backendPort int) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", bindAddress, frontendPort))
+func listenTCPProxy(bindAddress string, port int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", bindAddress, port))
 	if err != nil {
-		return fmt.Errorf("failed to listen on %s:%d: %w", bindAddress, frontendPort, err)
+		return nil, fmt.Errorf("failed to listen on %s:%d: %w", bindAddress, port, err)
 	}
-	defer listener.Close()
+	return listener, nil
+}
+
+func listenUnixProxy(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to chmod %s: %w", path, err)
+	}
+	return listener, nil
+}
 
-	slog.Info("TCP proxy listening", "address", fmt.Sprintf("%s:%d", bindAddress, frontendPort), "backend", fmt.Sprintf("127.0.0.1:%d", backendPort))
+// removeStaleSocket removes the unix domain socket file left by a previous run.
+// It refuses to remove a file that is not a socket.
+func removeStaleSocket(path string) error {
+	st, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if st.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	slog.Debug("removing stale socket", "path", path)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+	return nil
+}
 
+// serveProxy accepts connections on the listener and forwards them to the backends until the context is cancelled
+func (app *Ecsta) serveProxy(ctx context.Context, listener net.Listener, backends *proxyBackends) error {
 	// Close listener when context is cancelled
 	go func() {
 		<-ctx.Done()
@@ -181,7 +545,16 @@ func (app *Ecsta) startTCPProxyToLocalhost(ctx context.Context, bindAddress stri
 			}
 		}
 
-		go app.handleProxyConnection(ctx, conn, backendPort)
+		backend, err := backends.pick()
+		if err != nil {
+			slog.Warn("no backend to connect", "client", conn.RemoteAddr(), "error", err)
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer backends.release(backend)
+			app.handleProxyConnection(ctx, conn, backend.port)
+		}()
 	}
 }
 
@@ -240,3 +613,394 @@ func (app *Ecsta) handleProxyConnection(ctx context.Context, clientConn net.Conn
 		wg.Wait()
 	}
 }
+
+type proxyBackendContextKey struct{}
+
+// newHTTPProxyHandler returns a reverse proxy handler that forwards requests to the backends
+// with the Host header and the additional headers, and writes access logs.
+func newHTTPProxyHandler(opt *PortforwardOption, backends *proxyBackends) (http.Handler, error) {
+	headers, err := parseHTTPHeaders(opt.AddHeader)
+	if err != nil {
+		return nil, err
+	}
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			be := r.In.Context().Value(proxyBackendContextKey{}).(*proxyBackend)
+			r.SetURL(&url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", be.port)})
+			r.Out.Host = r.In.Host // preserve the Host header as raw TCP forwarding does
+			if opt.HostHeader != "" {
+				r.Out.Host = opt.HostHeader
+			}
+			// injected headers replace the headers of the same name sent by the client
+			for name, values := range headers {
+				for i, v := range values {
+					if i == 0 {
+						r.Out.Header.Set(name, v)
+					} else {
+						r.Out.Header.Add(name, v)
+					}
+				}
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("failed to proxy request", "method", r.Method, "url", r.URL.String(), "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &accessLogRecorder{ResponseWriter: w}
+		be, err := backends.pick()
+		if err != nil {
+			http.Error(rec, err.Error(), http.StatusBadGateway)
+		} else {
+			defer backends.release(be)
+			rp.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), proxyBackendContextKey{}, be)))
+		}
+		attrs := []any{
+			"method", r.Method,
+			"url", r.URL.String(),
+			"host", r.Host,
+			"status", rec.statusCode(),
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			"client", r.RemoteAddr,
+		}
+		if be != nil && be.taskID != "" {
+			attrs = append(attrs, "task", be.taskID)
+		}
+		slog.Info("access", attrs...)
+	}), nil
+}
+
+// serveHTTPProxy serves the HTTP reverse proxy on the listener until the context is cancelled
+func (app *Ecsta) serveHTTPProxy(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return ctx.Err()
+}
+
+// parseHTTPHeaders parses headers formatted as "Name: value".
+func parseHTTPHeaders(ss []string) (http.Header, error) {
+	h := http.Header{}
+	for _, s := range ss {
+		name, value, ok := strings.Cut(s, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header format: %q (expected 'Name: value')", s)
+		}
+		h.Add(name, strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// accessLogRecorder records the status code and the size of the response for access logs.
+type accessLogRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *accessLogRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessLogRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to flush the response while streaming.
+func (r *accessLogRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *accessLogRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+const (
+	proxyBalanceRoundRobin = "round-robin"
+	proxyBalanceLeastConn  = "least-conn"
+)
+
+// proxyBackend is a Session Manager Plugin listening on 127.0.0.1:port for the task.
+type proxyBackend struct {
+	taskID string
+	port   int
+	conns  int
+}
+
+// proxyBackends is a set of backends that the local proxy balances connections across.
+type proxyBackends struct {
+	mu       sync.Mutex
+	strategy string
+	backends []*proxyBackend
+	removed  map[string]bool
+	next     int
+}
+
+func newProxyBackends(strategy string) *proxyBackends {
+	if strategy == "" {
+		strategy = proxyBalanceRoundRobin
+	}
+	return &proxyBackends{
+		strategy: strategy,
+		removed:  map[string]bool{},
+	}
+}
+
+// add adds a backend. It returns false when the backend of the task is already added or removed.
+func (b *proxyBackends) add(taskID string, port int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.removed[taskID] {
+		return false
+	}
+	for _, be := range b.backends {
+		if be.taskID == taskID {
+			return false
+		}
+	}
+	b.backends = append(b.backends, &proxyBackend{taskID: taskID, port: port})
+	return true
+}
+
+// remove removes the backend of the task. The removed task is never added again.
+func (b *proxyBackends) remove(taskID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removed[taskID] = true
+	b.backends = lo.Filter(b.backends, func(be *proxyBackend, _ int) bool {
+		return be.taskID != taskID
+	})
+}
+
+func (b *proxyBackends) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.backends)
+}
+
+// pick chooses a backend by the strategy. The caller must call release after the connection is closed.
+func (b *proxyBackends) pick() (*proxyBackend, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.backends) == 0 {
+		return nil, fmt.Errorf("no backends available")
+	}
+	var be *proxyBackend
+	switch b.strategy {
+	case proxyBalanceLeastConn:
+		// the fewest connections wins. ties are broken by round-robin order
+		for i := range b.backends {
+			c := b.backends[(b.next+i)%len(b.backends)]
+			if be == nil || c.conns < be.conns {
+				be = c
+			}
+		}
+		b.next = (b.next + 1) % len(b.backends)
+	default: // round-robin
+		be = b.backends[b.next%len(b.backends)]
+		b.next = (b.next + 1) % len(b.backends)
+	}
+	be.conns++
+	return be, nil
+}
+
+func (b *proxyBackends) release(be *proxyBackend) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	be.conns--
+}
+
+func (b *proxyBackends) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ss := make([]string, 0, len(b.backends))
+	for _, be := range b.backends {
+		ss = append(ss, fmt.Sprintf("127.0.0.1:%d", be.port))
+	}
+	return strings.Join(ss, ",")
+}
+
+// lineWatcher is an io.Writer that passes through to w and calls fn once
+// when a line containing pattern is written.
+type lineWatcher struct {
+	w       io.Writer
+	pattern string
+	fn      func(line string)
+
+	mu    sync.Mutex
+	buf   []byte
+	fired bool
+}
+
+func newLineWatcher(w io.Writer, pattern string, fn func(line string)) *lineWatcher {
+	return &lineWatcher{w: w, pattern: pattern, fn: fn}
+}
+
+func (lw *lineWatcher) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	if !lw.fired {
+		lw.buf = append(lw.buf, p...)
+		for {
+			i := bytes.IndexByte(lw.buf, '\n')
+			if i < 0 {
+				break
+			}
+			line := strings.TrimRight(string(lw.buf[:i]), "\r")
+			lw.buf = lw.buf[i+1:]
+			if strings.Contains(line, lw.pattern) {
+				lw.fired = true
+				lw.buf = nil
+				lw.fn(line)
+				break
+			}
+		}
+	}
+	lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// portforwardReady is the readiness information of the port forwarding.
+type portforwardReady struct {
+	Network    string   `json:"network"`
+	Address    string   `json:"address"`
+	Port       int      `json:"port,omitempty"`
+	Tasks      []string `json:"tasks"`
+	Container  string   `json:"container"`
+	RemoteHost string   `json:"remote_host,omitempty"`
+	RemotePort int      `json:"remote_port"`
+}
+
+func newPortforwardReady(addr net.Addr, opt *PortforwardOption, taskIDs []string) *portforwardReady {
+	r := &portforwardReady{
+		Network:    addr.Network(),
+		Address:    addr.String(),
+		Tasks:      taskIDs,
+		Container:  opt.Container,
+		RemoteHost: opt.RemoteHost,
+		RemotePort: opt.RemotePort,
+	}
+	if ta, ok := addr.(*net.TCPAddr); ok {
+		r.Port = ta.Port
+	}
+	return r
+}
+
+// parsePortforwardOpenedPort parses the port number from "Port 54321 opened for sessionId xxxx."
+func parsePortforwardOpenedPort(line string) int {
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if f == "Port" && i+1 < len(fields) {
+			if port, err := strconv.Atoi(fields[i+1]); err == nil {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// portforwardReadiness signals the readiness of the port forwarding by --ready-file and --print-ready-json.
+type portforwardReadiness struct {
+	opt   *PortforwardOption
+	ready chan struct{}
+	once  sync.Once
+}
+
+func newPortforwardReadiness(opt *PortforwardOption) *portforwardReadiness {
+	return &portforwardReadiness{
+		opt:   opt,
+		ready: make(chan struct{}),
+	}
+}
+
+func (r *portforwardReadiness) enabled() bool {
+	return r.opt.ReadyFile != "" || r.opt.PrintReadyJSON
+}
+
+// notify signals the readiness. Only the first call takes effect.
+func (r *portforwardReadiness) notify(info *portforwardReady) {
+	r.once.Do(func() {
+		defer close(r.ready)
+		slog.Info("port forwarding is ready", "network", info.Network, "address", info.Address)
+		b, err := json.Marshal(info)
+		if err != nil {
+			slog.Error("failed to marshal readiness", "error", err)
+			return
+		}
+		b = append(b, '\n')
+		if r.opt.PrintReadyJSON {
+			r.opt.stdout.Write(b)
+		}
+		if r.opt.ReadyFile != "" {
+			if err := writeFileAtomic(r.opt.ReadyFile, b, 0644); err != nil {
+				slog.Error("failed to write ready file", "path", r.opt.ReadyFile, "error", err)
+			}
+		}
+	})
+}
+
+// watch cancels the context with errPortforwardNotReady when the port forwarding is not ready within the timeout.
+func (r *portforwardReadiness) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	if !r.enabled() || r.opt.ReadyTimeout <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-r.ready:
+	case <-time.After(r.opt.ReadyTimeout):
+		cancel(fmt.Errorf("%w within %s", errPortforwardNotReady, r.opt.ReadyTimeout))
+	}
+}
+
+// cleanup removes the ready file not to leave a stale address.
+func (r *portforwardReadiness) cleanup() {
+	if r.opt.ReadyFile == "" {
+		return
+	}
+	if err := os.Remove(r.opt.ReadyFile); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to remove ready file", "path", r.opt.ReadyFile, "error", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to name,
+// so that readers never see a partially written file.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
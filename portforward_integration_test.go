@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -76,9 +80,17 @@ func TestTCPProxyToLocalhost(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
+	listener, err := listenTCPProxy("0.0.0.0", proxyPort)
+	if err != nil {
+		t.Fatal("Failed to listen proxy:", err)
+	}
+	defer listener.Close()
+	backends := newProxyBackends(proxyBalanceRoundRobin)
+	backends.add("", backendPort)
+
 	var proxyWg sync.WaitGroup
 	proxyWg.Go(func() {
-		err := app.startTCPProxyToLocalhost(ctx, "0.0.0.0", proxyPort, backendPort)
+		err := app.serveProxy(ctx, listener, backends)
 		if err != nil && err != context.DeadlineExceeded && err != context.Canceled {
 			t.Logf("Proxy ended with: %v", err)
 		}
@@ -228,3 +240,218 @@ func TestHandleProxyConnection(t *testing.T) {
 		t.Log("Warning: proxy goroutine did not finish within timeout")
 	}
 }
+
+// TestUnixProxyToLocalhost tests the unix domain socket proxy functionality
+func TestUnixProxyToLocalhost(t *testing.T) {
+	// Start echo backend server (this simulates Session Manager Plugin)
+	backendListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to start backend:", err)
+	}
+	defer backendListener.Close()
+	backendPort := backendListener.Addr().(*net.TCPAddr).Port
+
+	go func() {
+		for {
+			conn, err := backendListener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				io.Copy(c, c) // Echo
+			}(conn)
+		}
+	}()
+
+	socketPath := filepath.Join(t.TempDir(), "proxy.sock")
+
+	app := &Ecsta{}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	listener, err := listenUnixProxy(socketPath)
+	if err != nil {
+		t.Fatal("Failed to listen proxy:", err)
+	}
+	defer listener.Close() // the socket file is removed on close
+	backends := newProxyBackends(proxyBalanceRoundRobin)
+	backends.add("", backendPort)
+
+	var proxyWg sync.WaitGroup
+	proxyWg.Go(func() {
+		err := app.serveProxy(ctx, listener, backends)
+		if err != nil && err != context.DeadlineExceeded && err != context.Canceled {
+			t.Logf("Proxy ended with: %v", err)
+		}
+	})
+
+	// Wait a bit for proxy to start
+	time.Sleep(50 * time.Millisecond)
+
+	st, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal("socket file is not created:", err)
+	}
+	if perm := st.Mode().Perm(); perm != 0600 {
+		t.Errorf("unexpected socket permission: %o", perm)
+	}
+
+	clientConn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal("Failed to connect to proxy:", err)
+	}
+	defer clientConn.Close()
+
+	testData := "Hello, Unix Proxy!"
+	if _, err := clientConn.Write([]byte(testData)); err != nil {
+		t.Fatal("Failed to write data:", err)
+	}
+	buffer := make([]byte, len(testData))
+	if _, err := io.ReadFull(clientConn, buffer); err != nil {
+		t.Fatal("Failed to read data:", err)
+	}
+	if string(buffer) != testData {
+		t.Errorf("Data mismatch: got %q, want %q", string(buffer), testData)
+	}
+	clientConn.Close()
+
+	cancel()
+	proxyWg.Wait()
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file should be removed after the proxy stopped: %v", err)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	// not exists
+	if err := removeStaleSocket(filepath.Join(dir, "none.sock")); err != nil {
+		t.Errorf("unexpected error for non-existent path: %v", err)
+	}
+
+	// regular file must not be removed
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(regular); err == nil {
+		t.Error("expected error for a regular file")
+	}
+
+	// socket in use must not be removed
+	inUse := filepath.Join(dir, "inuse.sock")
+	listener, err := net.Listen("unix", inUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(inUse); err == nil {
+		t.Error("expected error for a socket in use")
+	}
+	listener.Close()
+
+	// stale socket is removed
+	stale := filepath.Join(dir, "stale.sock")
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul.SetUnlinkOnClose(false)
+	ul.Close()
+	if err := removeStaleSocket(stale); err != nil {
+		t.Errorf("unexpected error for a stale socket: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale socket should be removed: %v", err)
+	}
+}
+
+// TestHTTPProxy tests the HTTP reverse proxy mode with header injection
+func TestHTTPProxy(t *testing.T) {
+	type received struct {
+		host string
+		auth []string
+		foo  string
+		bar  []string
+	}
+	got := make(chan received, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- received{
+			host: r.Host,
+			auth: r.Header.Values("Authorization"),
+			foo:  r.Header.Get("X-Foo"),
+			bar:  r.Header.Values("X-Bar"),
+		}
+		io.WriteString(w, "hello")
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	backends := newProxyBackends(proxyBalanceRoundRobin)
+	backends.add("task1", backendPort)
+	handler, err := newHTTPProxyHandler(&PortforwardOption{
+		HTTP:       true,
+		HostHeader: "internal.example.com",
+		AddHeader:  []string{"Authorization: Bearer xxx", "X-Foo:bar, baz", "X-Bar: 1", "X-Bar: 2"},
+	}, backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &Ecsta{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var proxyWg sync.WaitGroup
+	proxyWg.Go(func() {
+		app.serveHTTPProxy(ctx, listener, handler)
+	})
+
+	// headers sent by the client conflict with the injected headers
+	req, err := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/path", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer client")
+	req.Header.Set("X-Bar", "0")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("unexpected response: %d %s", res.StatusCode, body)
+	}
+	r := <-got
+	if r.host != "internal.example.com" {
+		t.Errorf("Host header got %q, want %q", r.host, "internal.example.com")
+	}
+	if len(r.auth) != 1 || r.auth[0] != "Bearer xxx" {
+		t.Errorf("Authorization header got %q", r.auth)
+	}
+	if r.foo != "bar, baz" {
+		t.Errorf("X-Foo header got %q", r.foo)
+	}
+	if len(r.bar) != 2 || r.bar[0] != "1" || r.bar[1] != "2" {
+		t.Errorf("X-Bar header got %q", r.bar)
+	}
+
+	// no backends
+	backends.remove("task1")
+	res, err = http.Get("http://" + listener.Addr().String() + "/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("status code got %d, want %d", res.StatusCode, http.StatusBadGateway)
+	}
+
+	cancel()
+	proxyWg.Wait()
+}
@@ -2,8 +2,18 @@ package ecsta
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 )
 
 func TestPortforwardOption_ParseL(t *testing.T) {
@@ -31,6 +41,15 @@ func TestPortforwardOption_ParseL(t *testing.T) {
 				RemotePort: 3306,
 			},
 		},
+		{
+			name: "remote port inferred",
+			L:    "8080::",
+			want: PortforwardOption{
+				LocalPort:  8080,
+				RemoteHost: "",
+				RemotePort: 0,
+			},
+		},
 		{
 			name: "empty L",
 			L:    "",
@@ -185,3 +204,245 @@ func TestPortforwardOption_PublicFlagValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestContainerPortMappings(t *testing.T) {
+	td := &types.TaskDefinition{
+		ContainerDefinitions: []types.ContainerDefinition{
+			{
+				Name: aws.String("app"),
+				PortMappings: []types.PortMapping{
+					{ContainerPort: aws.Int32(8080), Protocol: types.TransportProtocolTcp, Name: aws.String("http")},
+					{ContainerPortRange: aws.String("9000-9010")},
+					{ContainerPort: aws.Int32(9090)},
+				},
+			},
+			{
+				Name: aws.String("sidecar"),
+			},
+		},
+	}
+	tests := []struct {
+		container string
+		want      []string
+	}{
+		{container: "app", want: []string{"8080\ttcp\thttp", "9090"}},
+		{container: "sidecar", want: nil},
+		{container: "unknown", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.container, func(t *testing.T) {
+			var got []string
+			for _, m := range containerPortMappings(td, tt.container) {
+				got = append(got, formatPortMapping(m))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIsPortAvailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if isPortAvailable("127.0.0.1", port) {
+		t.Errorf("port %d is in use, but reported as available", port)
+	}
+	listener.Close()
+	if !isPortAvailable("127.0.0.1", port) {
+		t.Errorf("port %d is released, but reported as unavailable", port)
+	}
+}
+
+func TestProxyBackendsRoundRobin(t *testing.T) {
+	b := newProxyBackends(proxyBalanceRoundRobin)
+	if _, err := b.pick(); err == nil {
+		t.Error("pick should fail without backends")
+	}
+	b.add("a", 1001)
+	b.add("b", 1002)
+	b.add("c", 1003)
+	if b.add("a", 1004) {
+		t.Error("duplicated backend should not be added")
+	}
+
+	var got []int
+	for range 4 {
+		be, err := b.pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, be.port)
+	}
+	want := []int{1001, 1002, 1003, 1001}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pick #%d got %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	b.remove("b")
+	if b.len() != 2 {
+		t.Errorf("len got %d, want 2", b.len())
+	}
+	if b.add("b", 1002) {
+		t.Error("removed backend should not be added again")
+	}
+	for range 4 {
+		be, _ := b.pick()
+		if be.taskID == "b" {
+			t.Error("removed backend is picked")
+		}
+	}
+}
+
+func TestProxyBackendsLeastConn(t *testing.T) {
+	b := newProxyBackends(proxyBalanceLeastConn)
+	b.add("a", 1001)
+	b.add("b", 1002)
+
+	first, _ := b.pick()
+	second, _ := b.pick()
+	if first.taskID == second.taskID {
+		t.Errorf("connections should be spread: %s, %s", first.taskID, second.taskID)
+	}
+	third, _ := b.pick() // both have 1 connection
+	b.release(first)
+	b.release(second)
+	// the backend that third is not connected has the fewest connections
+	fourth, _ := b.pick()
+	if fourth.taskID == third.taskID {
+		t.Errorf("backend with the fewest connections should be picked: got %s", fourth.taskID)
+	}
+}
+
+func TestLineWatcher(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var fired []string
+	lw := newLineWatcher(buf, portforwardReadyMessage, func(line string) {
+		fired = append(fired, line)
+	})
+	for _, s := range []string{
+		"Starting session with SessionId: xxx\r\n",
+		"Port 8080 opened for sessionId xxx.\r\nWaiting for ",
+		"connections...\r\n",
+		"Waiting for connections...\r\n",
+	} {
+		if _, err := lw.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fired) != 1 || fired[0] != "Waiting for connections..." {
+		t.Errorf("unexpected fired lines: %q", fired)
+	}
+	if !strings.HasPrefix(buf.String(), "Starting session") || !strings.HasSuffix(buf.String(), "connections...\r\n") {
+		t.Errorf("output is not passed through: %q", buf.String())
+	}
+}
+
+func TestParsePortforwardOpenedPort(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{line: "Port 54321 opened for sessionId user-0123456789abcdef.", want: 54321},
+		{line: "Waiting for connections...", want: 0},
+		{line: "Port abc opened for sessionId user-0123456789abcdef.", want: 0},
+	}
+	for _, tt := range tests {
+		if got := parsePortforwardOpenedPort(tt.line); got != tt.want {
+			t.Errorf("parsePortforwardOpenedPort(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestPortforwardReadiness(t *testing.T) {
+	readyFile := filepath.Join(t.TempDir(), "ready.json")
+	stdout := &bytes.Buffer{}
+	opt := &PortforwardOption{
+		Container:      "db",
+		RemotePort:     5432,
+		ReadyFile:      readyFile,
+		PrintReadyJSON: true,
+		stdout:         stdout,
+	}
+	r := newPortforwardReadiness(opt)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 54321}
+	r.notify(newPortforwardReady(addr, opt, []string{"task1"}))
+	r.notify(newPortforwardReady(addr, opt, []string{"task2"})) // ignored
+
+	want := `{"network":"tcp","address":"127.0.0.1:54321","port":54321,"tasks":["task1"],"container":"db","remote_port":5432}` + "\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("printed ready JSON got %s, want %s", got, want)
+	}
+	b, err := os.ReadFile(readyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("ready file got %s, want %s", string(b), want)
+	}
+	select {
+	case <-r.ready:
+	default:
+		t.Error("ready channel is not closed")
+	}
+
+	r.cleanup()
+	if _, err := os.Stat(readyFile); !os.IsNotExist(err) {
+		t.Errorf("ready file should be removed: %v", err)
+	}
+}
+
+func TestPortforwardPluginStdout(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	opt := &PortforwardOption{stdout: stdout, stderr: stderr}
+	if opt.pluginStdout() != io.Writer(stdout) {
+		t.Error("output of Session Manager Plugin should be written to stdout")
+	}
+	opt.PrintReadyJSON = true
+	if opt.pluginStdout() != io.Writer(stderr) {
+		t.Error("output of Session Manager Plugin should be written to stderr with --print-ready-json")
+	}
+}
+
+func TestPortforwardReadinessTimeout(t *testing.T) {
+	opt := &PortforwardOption{
+		PrintReadyJSON: true,
+		ReadyTimeout:   10 * time.Millisecond,
+		stdout:         &bytes.Buffer{},
+	}
+	r := newPortforwardReadiness(opt)
+	ctx, cancel := context.WithCancelCause(t.Context())
+	defer cancel(nil)
+	r.watch(ctx, cancel)
+	if cause := context.Cause(ctx); !errors.Is(cause, errPortforwardNotReady) {
+		t.Errorf("context should be cancelled by errPortforwardNotReady: %v", cause)
+	}
+}
+
+func TestParseHTTPHeaders(t *testing.T) {
+	h, err := parseHTTPHeaders([]string{"Authorization: Bearer xxx", "x-foo:bar", "X-Foo: baz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := h.Get("Authorization"); v != "Bearer xxx" {
+		t.Errorf("Authorization got %q", v)
+	}
+	if v := h.Values("X-Foo"); len(v) != 2 || v[0] != "bar" || v[1] != "baz" {
+		t.Errorf("X-Foo got %q", v)
+	}
+	for _, s := range []string{"invalid", ": value"} {
+		if _, err := parseHTTPHeaders([]string{s}); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
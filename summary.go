@@ -0,0 +1,131 @@
+package ecsta
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// summaryColumns are the columns of the summary following the group columns.
+var summaryColumns = []string{
+	"Running",
+	"Pending",
+	"Stopping",
+	"StoppedLastHour",
+	"TaskDefinitions",
+	"LaunchTypes",
+}
+
+// summaryStoppedWithin is the period to count stopped tasks in the summary.
+const summaryStoppedWithin = time.Hour
+
+// taskSummary is the number of tasks in a group.
+type taskSummary struct {
+	keys            []string
+	running         int
+	pending         int
+	stopping        int
+	stopped         int            // stopped within summaryStoppedWithin
+	taskDefinitions map[string]int // task definition (family:revision) -> number of tasks not stopped
+	launchTypes     map[string]int // launch type -> number of tasks not stopped
+}
+
+func (s *taskSummary) add(task types.Task, now time.Time) {
+	switch aws.ToString(task.LastStatus) {
+	case "RUNNING":
+		s.running++
+	case "STOPPED", "DELETED":
+		if task.StoppedAt != nil && now.Sub(*task.StoppedAt) <= summaryStoppedWithin {
+			s.stopped++
+		}
+		return
+	case "DEACTIVATING", "STOPPING", "DEPROVISIONING":
+		s.stopping++
+	default: // PROVISIONING, PENDING, ACTIVATING
+		s.pending++
+	}
+	s.taskDefinitions[arnToName(aws.ToString(task.TaskDefinitionArn))]++
+	if lt := string(task.LaunchType); lt != "" {
+		s.launchTypes[lt]++
+	}
+}
+
+func (s *taskSummary) row() []string {
+	// the newest revision first
+	tds := slices.SortedFunc(maps.Keys(s.taskDefinitions), func(a, b string) int {
+		return compareTaskDefinition(b, a)
+	})
+	return append(slices.Clone(s.keys),
+		strconv.Itoa(s.running),
+		strconv.Itoa(s.pending),
+		strconv.Itoa(s.stopping),
+		strconv.Itoa(s.stopped),
+		formatCounts(tds, s.taskDefinitions),
+		formatCounts(slices.Sorted(maps.Keys(s.launchTypes)), s.launchTypes),
+	)
+}
+
+// formatCounts formats counts as "key (n), ...".
+func formatCounts(keys []string, counts map[string]int) string {
+	ss := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ss = append(ss, fmt.Sprintf("%s (%d)", k, counts[k]))
+	}
+	return strings.Join(ss, ", ")
+}
+
+// summarizeTasks groups tasks by the keys and counts them. Summaries are sorted by the keys.
+// Stopped tasks are counted only when they stopped within summaryStoppedWithin before now.
+func summarizeTasks(tasks []types.Task, keyFunc func(types.Task) []string, now time.Time) []*taskSummary {
+	groups := map[string]*taskSummary{}
+	for _, task := range tasks {
+		keys := keyFunc(task)
+		id := strings.Join(keys, "\x00")
+		s, ok := groups[id]
+		if !ok {
+			s = &taskSummary{
+				keys:            keys,
+				taskDefinitions: map[string]int{},
+				launchTypes:     map[string]int{},
+			}
+			groups[id] = s
+		}
+		s.add(task, now)
+	}
+	return slices.SortedFunc(maps.Values(groups), func(a, b *taskSummary) int {
+		return cmp.Compare(strings.Join(a.keys, "\x00"), strings.Join(b.keys, "\x00"))
+	})
+}
+
+// printSummary writes the number of tasks by the group (service or family) in the output format.
+// Tasks are also grouped by the profile, region and cluster when they are listed across them.
+func (app *Ecsta) printSummary(w io.Writer, list *taskList, opt *ListOption) error {
+	fopt := formatterOption{
+		Columns:     []string{"Group"},
+		WithCluster: opt.AllClusters,
+		WithRegion:  len(opt.Regions) > 0,
+		WithProfile: len(opt.Profiles) > 0,
+		Profiles:    list.profiles,
+	}
+	if err := fopt.prepare(); err != nil {
+		return err
+	}
+	f, err := newRowFormatter(w, app.Config.Output, append(fopt.columns(), summaryColumns...))
+	if err != nil {
+		return fmt.Errorf("failed to create formatter: %w", err)
+	}
+	for _, s := range summarizeTasks(list.tasks, fopt.taskToColumns, flextime.Now()) {
+		f.AddRow(s.row())
+	}
+	f.Close()
+	return nil
+}
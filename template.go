@@ -0,0 +1,134 @@
+package ecsta
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/template"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// taskTemplateFuncs are the helper functions for Go templates of tasks.
+var taskTemplateFuncs = template.FuncMap{
+	"name":      templateName,
+	"ago":       templateAgo,
+	"tag":       templateTag,
+	"container": templateContainer,
+}
+
+// templateName returns the last part of the ARN (e.g. the task ID).
+func templateName(v any) string {
+	switch v := v.(type) {
+	case string:
+		return arnToName(v)
+	case *string:
+		return arnToName(aws.ToString(v))
+	}
+	return fmt.Sprint(v)
+}
+
+// templateAgo returns the elapsed time since the time, in a rough unit (e.g. "3m ago").
+func templateAgo(v any) string {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		t = *v
+	default:
+		return ""
+	}
+	return formatAgo(flextime.Now().Sub(t))
+}
+
+func formatAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// templateTag returns the value of the tag of the task. v is a task or tags.
+func templateTag(key string, v any) string {
+	var tags []types.Tag
+	switch v := v.(type) {
+	case types.Task:
+		tags = v.Tags
+	case []types.Tag:
+		tags = v
+	}
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// templateContainer returns the container of the task by the name. v is a task or containers.
+// The zero value is returned when the container is not found.
+func templateContainer(name string, v any) types.Container {
+	var containers []types.Container
+	switch v := v.(type) {
+	case types.Task:
+		containers = v.Containers
+	case []types.Container:
+		containers = v
+	}
+	for _, c := range containers {
+		if aws.ToString(c.Name) == name {
+			return c
+		}
+	}
+	return types.Container{}
+}
+
+// taskFormatterTemplate formats a task per line by the Go template.
+type taskFormatterTemplate struct {
+	w            io.Writer
+	tmpl         *template.Template
+	appendTaskID bool
+}
+
+func newTaskFormatterTemplate(w io.Writer, opt formatterOption) (taskFormatter, error) {
+	tmpl, err := template.New("task").Funcs(taskTemplateFuncs).Parse(opt.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return &taskFormatterTemplate{
+		w:            w,
+		tmpl:         tmpl,
+		appendTaskID: opt.AppendTaskID,
+	}, nil
+}
+
+func (t *taskFormatterTemplate) AddTask(task types.Task) {
+	var buf bytes.Buffer
+	if t.appendTaskID {
+		// ensure task arn at the beginning of the line
+		buf.WriteString(arnToName(*task.TaskArn) + "\t")
+	}
+	if err := t.tmpl.Execute(&buf, task); err != nil {
+		slog.Warn("failed to execute template", "task", arnToName(*task.TaskArn), "error", err)
+		return
+	}
+	buf.WriteByte('\n')
+	buf.WriteTo(t.w)
+}
+
+func (t *taskFormatterTemplate) Close() {
+}
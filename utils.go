@@ -2,12 +2,19 @@ package ecsta
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/mattn/go-isatty"
 )
 
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
 func optional(s string) *string {
 	if s == "" {
 		return nil
@@ -23,6 +30,14 @@ func arnToResource(s string) string {
 	return an.Resource
 }
 
+func arnToRegion(s string) string {
+	an, err := arn.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return an.Region
+}
+
 func arnToName(s string) string {
 	ns := strings.Split(s, "/")
 	return ns[len(ns)-1]